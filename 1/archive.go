@@ -0,0 +1,446 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	archiveZip = "zip"
+	archiveTar = "tar"
+)
+
+// linkFS is a file system that can tell where its symlinks point.
+type linkFS interface {
+	fs.FS
+	ReadLink(name string) (string, error)
+}
+
+// osFS is the local directory dir. Unlike plain os.DirFS it reads
+// symlink targets, and fs.Stat on it follows links.
+type osFS struct {
+	fs.FS
+	dir string
+}
+
+func newOSFS(dir string) osFS {
+	return osFS{FS: os.DirFS(dir), dir: dir}
+}
+
+func (f osFS) ReadLink(name string) (string, error) {
+	return os.Readlink(filepath.Join(f.dir, filepath.FromSlash(name)))
+}
+
+// rootFS opens the walk root: a directory, or an archive file
+// which is then shown as if it was one.
+func rootFS(root string) (fs.FS, error) {
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() || archiveKind(root) == "" {
+		return newOSFS(root), nil
+	}
+	return loadArchive(root, info.Size(), func() (archiveFile, error) {
+		return os.Open(root)
+	})
+}
+
+// archiveKind detects supported archives by file name.
+func archiveKind(name string) string {
+	name = strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		return archiveZip
+	case strings.HasSuffix(name, ".tar"),
+		strings.HasSuffix(name, ".tar.gz"),
+		strings.HasSuffix(name, ".tgz"):
+		return archiveTar
+	}
+	return ""
+}
+
+// archiveFile is an archive being read: an *os.File, or the content of
+// an archive nested in another one.
+type archiveFile interface {
+	io.ReaderAt
+	io.Closer
+}
+
+// openArchive lists the archive name of fsys. Archives on disk are
+// read in place, the ones nested in other archives are loaded into
+// memory whole.
+func openArchive(fsys fs.FS, name string) (fs.FS, error) {
+	info, err := fs.Stat(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	return loadArchive(name, info.Size(), func() (archiveFile, error) {
+		f, err := fsys.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		if af, ok := f.(archiveFile); ok {
+			return af, nil
+		}
+		defer f.Close()
+		data, err := io.ReadAll(f)
+		if err != nil {
+			return nil, err
+		}
+		return nopCloser{bytes.NewReader(data)}, nil
+	})
+}
+
+type nopCloser struct {
+	io.ReaderAt
+}
+
+func (nopCloser) Close() error { return nil }
+
+// lazyFile is an archive of size bytes opened on the first read. It
+// is closed once its entries are listed, and only opened again if the
+// content of one of them is read.
+type lazyFile struct {
+	open func() (archiveFile, error)
+	size int64
+
+	mu sync.Mutex
+	f  archiveFile
+}
+
+func (l *lazyFile) ReadAt(p []byte, off int64) (int, error) {
+	l.mu.Lock()
+	if l.f == nil {
+		f, err := l.open()
+		if err != nil {
+			l.mu.Unlock()
+			return 0, err
+		}
+		l.f = f
+	}
+	f := l.f
+	l.mu.Unlock()
+	return f.ReadAt(p, off)
+}
+
+func (l *lazyFile) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f != nil {
+		l.f.Close()
+		l.f = nil
+	}
+}
+
+func (l *lazyFile) reader() *io.SectionReader {
+	return io.NewSectionReader(l, 0, l.size)
+}
+
+// loadArchive builds the tree of an archive of size bytes from the
+// headers of its entries. Their contents are read when they are opened.
+func loadArchive(name string, size int64, open func() (archiveFile, error)) (fs.FS, error) {
+	file := &lazyFile{open: open, size: size}
+	defer file.release()
+	switch archiveKind(name) {
+	case archiveZip:
+		return loadZip(file)
+	case archiveTar:
+		return loadTar(file)
+	}
+	return nil, fmt.Errorf("%s: unknown archive type", name)
+}
+
+func loadZip(file *lazyFile) (fs.FS, error) {
+	zr, err := zip.NewReader(file, file.size)
+	if err != nil {
+		return nil, err
+	}
+	mfs := newMemFS()
+	for _, zf := range zr.File {
+		zf := zf
+		mode := zf.Mode()
+		entry := &memFile{mode: mode, modTime: zf.Modified, size: int64(zf.UncompressedSize64)}
+		if mode&fs.ModeSymlink != 0 {
+			// zip keeps the link target as the file content
+			target, err := readZipFile(zf)
+			if err != nil {
+				return nil, err
+			}
+			entry.target = string(target)
+		} else if !mode.IsDir() {
+			entry.open = func() (io.ReadCloser, error) { return zf.Open() }
+		}
+		mfs.add(zf.Name, entry)
+	}
+	return mfs, nil
+}
+
+func readZipFile(zf *zip.File) ([]byte, error) {
+	rc, err := zf.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+// loadTar reads the headers of a tar, gzipped or not. An entry of a
+// plain tar is read at its offset, and the contents between headers are
+// skipped without reading them. An entry of a gzipped tar is read by
+// decompressing the archive up to it again.
+func loadTar(file *lazyFile) (fs.FS, error) {
+	magic := make([]byte, 2)
+	n, _ := file.ReadAt(magic, 0)
+	gzipped := n == 2 && magic[0] == 0x1f && magic[1] == 0x8b
+
+	var r io.Reader
+	var offset func() int64
+	if gzipped {
+		gz, err := gzip.NewReader(file.reader())
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		cr := &countingReader{r: gz}
+		r, offset = cr, func() int64 { return cr.n }
+	} else {
+		// tar seeks over the contents of a seeker
+		sr := file.reader()
+		r, offset = sr, func() int64 {
+			n, _ := sr.Seek(0, io.SeekCurrent)
+			return n
+		}
+	}
+
+	tr := tar.NewReader(r)
+	mfs := newMemFS()
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		entry := &memFile{mode: hdr.FileInfo().Mode(), modTime: hdr.ModTime}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			entry.mode |= fs.ModeDir
+		case tar.TypeSymlink:
+			entry.target = hdr.Linkname
+		default:
+			// Next stops right at the content of the entry
+			start, size := offset(), hdr.Size
+			entry.size = size
+			entry.open = func() (io.ReadCloser, error) {
+				return openTarEntry(file, start, size, gzipped)
+			}
+		}
+		mfs.add(hdr.Name, entry)
+	}
+	return mfs, nil
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func openTarEntry(file *lazyFile, start, size int64, gzipped bool) (io.ReadCloser, error) {
+	if !gzipped {
+		return io.NopCloser(io.NewSectionReader(file, start, size)), nil
+	}
+	gz, err := gzip.NewReader(file.reader())
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.CopyN(io.Discard, gz, start); err != nil {
+		gz.Close()
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(gz, size), gz}, nil
+}
+
+// memFS is a read-only in-memory file system built from archive entries.
+type memFS struct {
+	files map[string]*memFile
+}
+
+// memFile is both a file and its fs.FileInfo and fs.DirEntry.
+type memFile struct {
+	name    string
+	mode    fs.FileMode
+	size    int64
+	modTime time.Time
+	target  string
+	// open reads the content, nil for the entries having none
+	open     func() (io.ReadCloser, error)
+	children []*memFile
+}
+
+func (f *memFile) Name() string               { return f.name }
+func (f *memFile) Size() int64                { return f.size }
+func (f *memFile) Mode() fs.FileMode          { return f.mode }
+func (f *memFile) ModTime() time.Time         { return f.modTime }
+func (f *memFile) IsDir() bool                { return f.mode.IsDir() }
+func (f *memFile) Sys() interface{}           { return nil }
+func (f *memFile) Type() fs.FileMode          { return f.mode.Type() }
+func (f *memFile) Info() (fs.FileInfo, error) { return f, nil }
+
+func newMemFS() *memFS {
+	root := &memFile{name: ".", mode: fs.ModeDir | 0555}
+	return &memFS{files: map[string]*memFile{".": root}}
+}
+
+// add puts file at name, creating the parent directories that the
+// archive does not list itself. Entries are kept sorted by name.
+func (mfs *memFS) add(name string, file *memFile) {
+	name = path.Clean("/" + name)[1:]
+	if name == "" {
+		return
+	}
+	if old, ok := mfs.files[name]; ok {
+		if old.IsDir() && file.IsDir() {
+			old.mode, old.modTime = file.mode, file.modTime
+		}
+		return
+	}
+	dir, base := path.Split(name)
+	dir = strings.TrimSuffix(dir, "/")
+	if dir == "" {
+		dir = "."
+	}
+	parent, ok := mfs.files[dir]
+	if !ok {
+		parent = &memFile{mode: fs.ModeDir | 0555}
+		mfs.add(dir, parent)
+		parent = mfs.files[dir]
+	}
+	file.name = base
+	mfs.files[name] = file
+	i := sort.Search(len(parent.children), func(i int) bool {
+		return parent.children[i].name >= base
+	})
+	parent.children = append(parent.children, nil)
+	copy(parent.children[i+1:], parent.children[i:])
+	parent.children[i] = file
+}
+
+func (mfs *memFS) lookup(op, name string) (*memFile, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	file, ok := mfs.files[name]
+	if !ok {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	return file, nil
+}
+
+func (mfs *memFS) Open(name string) (fs.File, error) {
+	file, err := mfs.lookup("open", name)
+	if err != nil {
+		return nil, err
+	}
+	return &openMemFile{file: file}, nil
+}
+
+func (mfs *memFS) Stat(name string) (fs.FileInfo, error) {
+	return mfs.lookup("stat", name)
+}
+
+func (mfs *memFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	file, err := mfs.lookup("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if !file.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+	entries := make([]fs.DirEntry, len(file.children))
+	for i, child := range file.children {
+		entries[i] = child
+	}
+	return entries, nil
+}
+
+func (mfs *memFS) ReadLink(name string) (string, error) {
+	file, err := mfs.lookup("readlink", name)
+	if err != nil {
+		return "", err
+	}
+	if file.mode&fs.ModeSymlink == 0 {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+	}
+	return file.target, nil
+}
+
+// openMemFile is an opened memFile with its own read offset. The
+// content is opened on the first read.
+type openMemFile struct {
+	file   *memFile
+	r      io.ReadCloser
+	dirPos int
+}
+
+func (f *openMemFile) Stat() (fs.FileInfo, error) { return f.file, nil }
+
+func (f *openMemFile) Read(p []byte) (int, error) {
+	if f.r == nil {
+		if f.file.open == nil {
+			return 0, io.EOF
+		}
+		r, err := f.file.open()
+		if err != nil {
+			return 0, err
+		}
+		f.r = r
+	}
+	return f.r.Read(p)
+}
+
+func (f *openMemFile) Close() error {
+	if f.r == nil {
+		return nil
+	}
+	return f.r.Close()
+}
+
+func (f *openMemFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	rest := f.file.children[f.dirPos:]
+	if n > 0 && len(rest) == 0 {
+		return nil, io.EOF
+	}
+	if n > 0 && n < len(rest) {
+		rest = rest[:n]
+	}
+	f.dirPos += len(rest)
+	entries := make([]fs.DirEntry, len(rest))
+	for i, child := range rest {
+		entries[i] = child
+	}
+	return entries, nil
+}
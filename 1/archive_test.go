@@ -0,0 +1,272 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// makeZip packs the files of src into a zip archive. Only files are
+// stored, so the directories have to be derived from their paths.
+func makeZip(t *testing.T, src string) []byte {
+	t.Helper()
+	buf := new(bytes.Buffer)
+	zw := zip.NewWriter(buf)
+	err := filepath.Walk(src, func(name string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(src, name)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		w, err := zw.Create(filepath.ToSlash(rel))
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	})
+	if err == nil {
+		err = zw.Close()
+	}
+	if err != nil {
+		t.Fatalf("cant make zip: %s", err)
+	}
+	return buf.Bytes()
+}
+
+// makeTarGz packs src into a gzipped tar with explicit directory entries.
+func makeTarGz(t *testing.T, src string) []byte {
+	t.Helper()
+	buf := new(bytes.Buffer)
+	gz := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gz)
+	err := filepath.Walk(src, func(name string, info os.FileInfo, err error) error {
+		if err != nil || name == src {
+			return err
+		}
+		rel, err := filepath.Rel(src, name)
+		if err != nil {
+			return err
+		}
+		hdr, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = "./" + filepath.ToSlash(rel)
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		_, err = tw.Write(data)
+		return err
+	})
+	if err == nil {
+		err = tw.Close()
+	}
+	if err == nil {
+		err = gz.Close()
+	}
+	if err != nil {
+		t.Fatalf("cant make tar: %s", err)
+	}
+	return buf.Bytes()
+}
+
+func TestTreeArchiveRoot(t *testing.T) {
+	expected := new(bytes.Buffer)
+	opts := options{printFiles: true, format: formatText}
+	if err := renderTree(expected, "testdata/static", opts); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	dir := t.TempDir()
+	archives := map[string][]byte{
+		"static.zip":    makeZip(t, "testdata/static"),
+		"static.tar.gz": makeTarGz(t, "testdata/static"),
+	}
+	for name, data := range archives {
+		root := filepath.Join(dir, name)
+		writeFile(t, root, string(data))
+		for _, workers := range []int{1, 4} {
+			opts.workers = workers
+			out := new(bytes.Buffer)
+			if err := renderTree(out, root, opts); err != nil {
+				t.Fatalf("%s: unexpected error: %s", name, err)
+			}
+			if result := out.String(); result != expected.String() {
+				t.Errorf("%s: results not match\nGot:\n%v\nExpected:\n%v", name, result, expected)
+			}
+		}
+	}
+}
+
+const testArchivesResult = `├───empty.txt (empty)
+├───lorem.tgz (%s)
+│	├───dolor.txt (empty)
+│	├───gopher.png (70372b)
+│	├───ipsum
+│	│	└───gopher.png (70372b)
+│	└───project.zip (%s)
+│		├───file.txt (19b)
+│		└───gopher.png (70372b)
+└───lorem.zip (%s)
+	├───dolor.txt (empty)
+	├───gopher.png (70372b)
+	└───ipsum
+		└───gopher.png (70372b)
+`
+
+func TestTreeArchivesInWalk(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "empty.txt"), "")
+	zipData := makeZip(t, "testdata/zline/lorem")
+	writeFile(t, filepath.Join(root, "lorem.zip"), string(zipData))
+
+	// a zip inside a tar inside the walked directory
+	nested := t.TempDir()
+	copyTree(t, "testdata/zline/lorem", nested)
+	projectZip := makeZip(t, "testdata/project")
+	writeFile(t, filepath.Join(nested, "project.zip"), string(projectZip))
+	tarData := makeTarGz(t, nested)
+	writeFile(t, filepath.Join(root, "lorem.tgz"), string(tarData))
+
+	out := new(bytes.Buffer)
+	opts := options{printFiles: true, format: formatText, archives: true}
+	if err := renderTree(out, root, opts); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := sprintfSizes(testArchivesResult, len(tarData), len(projectZip), len(zipData))
+	if result := out.String(); result != expected {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", result, expected)
+	}
+
+	// without --archives they are plain files
+	out.Reset()
+	opts.archives = false
+	if err := renderTree(out, root, opts); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected = sprintfSizes("├───empty.txt (empty)\n├───lorem.tgz (%s)\n└───lorem.zip (%s)\n", len(tarData), len(zipData))
+	if result := out.String(); result != expected {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", result, expected)
+	}
+}
+
+func TestTreeBrokenArchive(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "broken.zip"), "not a zip")
+
+	opts := options{printFiles: true, format: formatText, archives: true}
+	if err := renderTree(new(bytes.Buffer), root, opts); err == nil {
+		t.Errorf("expected error for broken archive")
+	}
+
+	out := new(bytes.Buffer)
+	opts.keepGoing = true
+	if err := renderTree(out, root, opts); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := "└───broken.zip (9b) [zip: not a valid zip file]\n"
+	if result := out.String(); result != expected {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", result, expected)
+	}
+}
+
+func TestArchiveContents(t *testing.T) {
+	tarGz := makeTarGz(t, "testdata/project")
+	gz, err := gzip.NewReader(bytes.NewReader(tarGz))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	plainTar, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	dir := t.TempDir()
+	archives := map[string][]byte{
+		"project.zip":    makeZip(t, "testdata/project"),
+		"project.tar":    plainTar,
+		"project.tar.gz": tarGz,
+	}
+	for name, data := range archives {
+		root := filepath.Join(dir, name)
+		writeFile(t, root, string(data))
+		fsys, err := rootFS(root)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", name, err)
+		}
+		if err := fstest.TestFS(fsys, "file.txt", "gopher.png"); err != nil {
+			t.Errorf("%s: not a valid fs.FS: %s", name, err)
+		}
+		// the contents are read from the archive on disk when opened
+		for _, file := range []string{"file.txt", "gopher.png"} {
+			got, err := fs.ReadFile(fsys, file)
+			if err != nil {
+				t.Fatalf("%s: unexpected error: %s", name, err)
+			}
+			expected, _ := os.ReadFile(filepath.Join("testdata/project", file))
+			if !bytes.Equal(got, expected) {
+				t.Errorf("%s: wrong content of %s", name, file)
+			}
+		}
+	}
+}
+
+func TestMemFS(t *testing.T) {
+	mfs := newMemFS()
+	mfs.add("b/c/file.txt", &memFile{open: contentOf("abc"), size: 3})
+	mfs.add("a.txt", &memFile{})
+	mfs.add("b/link", &memFile{mode: fs.ModeSymlink, target: "c"})
+
+	if err := fstest.TestFS(mfs, "a.txt", "b/c/file.txt", "b/link"); err != nil {
+		t.Fatalf("memFS is not a valid fs.FS: %s", err)
+	}
+
+	data, err := fs.ReadFile(mfs, "b/c/file.txt")
+	if err != nil || string(data) != "abc" {
+		t.Errorf("wrong file content %q, %v", data, err)
+	}
+	target, err := mfs.ReadLink("b/link")
+	if err != nil || target != "c" {
+		t.Errorf("wrong link target %q, %v", target, err)
+	}
+	if _, err := mfs.Open("missing"); err == nil {
+		t.Errorf("expected error for missing file")
+	}
+}
+
+func contentOf(data string) func() (io.ReadCloser, error) {
+	return func() (io.ReadCloser, error) {
+		return io.NopCloser(strings.NewReader(data)), nil
+	}
+}
+
+func sprintfSizes(format string, sizes ...int) string {
+	labels := make([]interface{}, len(sizes))
+	for i, size := range sizes {
+		labels[i] = sizeLabel(int64(size), false)
+	}
+	return fmt.Sprintf(format, labels...)
+}
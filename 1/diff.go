@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/fs"
+	"sort"
+	"strings"
+)
+
+const (
+	statusAdded   = "added"
+	statusRemoved = "removed"
+	statusChanged = "changed"
+
+	compareSize  = "size"
+	compareMtime = "mtime"
+	compareHash  = "hash"
+)
+
+// compareList is the comma separated --compare flag.
+type compareList []string
+
+func (c *compareList) String() string {
+	return strings.Join(*c, ",")
+}
+
+func (c *compareList) Set(value string) error {
+	list := compareList{}
+	for _, item := range strings.Split(value, ",") {
+		switch item {
+		case compareSize, compareMtime, compareHash:
+			list = append(list, item)
+		default:
+			return fmt.Errorf("unknown comparison %q", item)
+		}
+	}
+	*c = list
+	return nil
+}
+
+// diffTrees walks both roots with the same options and merges them into
+// one tree. Entries only in oldRoot are marked removed, the ones only in
+// newRoot added, and files that differ changed.
+func diffTrees(oldRoot, newRoot string, opts options) (*node, error) {
+	oldTree, err := walkTree(oldRoot, opts)
+	if err != nil {
+		return nil, err
+	}
+	newTree, err := walkTree(newRoot, opts)
+	if err != nil {
+		return nil, err
+	}
+	children, err := mergeLevel(oldTree.Children, newTree.Children, opts)
+	if err != nil {
+		return nil, err
+	}
+	newTree.Children = children
+	return newTree, nil
+}
+
+// mergeLevel merges two sorted levels the way a merge sort does,
+// so the result keeps the order of the plain tree.
+func mergeLevel(oldNodes, newNodes []*node, opts options) ([]*node, error) {
+	merged := make([]*node, 0, len(newNodes))
+	i, j := 0, 0
+	for i < len(oldNodes) || j < len(newNodes) {
+		switch {
+		case j == len(newNodes) || i < len(oldNodes) && oldNodes[i].Name < newNodes[j].Name:
+			merged = append(merged, markAll(oldNodes[i], statusRemoved))
+			i++
+		case i == len(oldNodes) || newNodes[j].Name < oldNodes[i].Name:
+			merged = append(merged, markAll(newNodes[j], statusAdded))
+			j++
+		default:
+			n, err := diffNode(oldNodes[i], newNodes[j], opts)
+			if err != nil {
+				return nil, err
+			}
+			merged = append(merged, n)
+			i++
+			j++
+		}
+	}
+	return merged, nil
+}
+
+func markAll(n *node, status string) *node {
+	n.Status = status
+	for _, child := range n.Children {
+		markAll(child, status)
+	}
+	return n
+}
+
+func diffNode(oldNode, newNode *node, opts options) (*node, error) {
+	if oldNode.Type != newNode.Type {
+		// nothing is shared: what was under the old entry is removed
+		children := make([]*node, 0, len(oldNode.Children)+len(newNode.Children))
+		for _, child := range newNode.Children {
+			children = append(children, markAll(child, statusAdded))
+		}
+		for _, child := range oldNode.Children {
+			children = append(children, markAll(child, statusRemoved))
+		}
+		sort.SliceStable(children, func(i, j int) bool { return children[i].Name < children[j].Name })
+		newNode.Children = children
+		newNode.Status, newNode.Changes = statusChanged, []string{"type"}
+		return newNode, nil
+	}
+	if newNode.isDir() {
+		children, err := mergeLevel(oldNode.Children, newNode.Children, opts)
+		if err != nil {
+			return nil, err
+		}
+		newNode.Children = children
+		return newNode, nil
+	}
+	changes, err := compareFiles(oldNode, newNode, opts.compare)
+	if err != nil {
+		return nil, err
+	}
+	if len(changes) > 0 {
+		newNode.Status, newNode.Changes = statusChanged, changes
+	}
+	return newNode, nil
+}
+
+// compareFiles lists what differs between two files or links.
+// Contents are hashed only when the sizes are equal.
+func compareFiles(oldNode, newNode *node, compare compareList) ([]string, error) {
+	var changes []string
+	if oldNode.Target != newNode.Target {
+		changes = append(changes, "target")
+	}
+	if newNode.Type != typeFile {
+		return changes, nil
+	}
+	for _, what := range compare {
+		switch what {
+		case compareSize:
+			if oldNode.Size != newNode.Size {
+				changes = append(changes, compareSize)
+			}
+		case compareMtime:
+			if !oldNode.modTime.Equal(newNode.modTime) {
+				changes = append(changes, compareMtime)
+			}
+		case compareHash:
+			if oldNode.Size != newNode.Size {
+				changes = append(changes, compareHash)
+				continue
+			}
+			same, err := sameContent(oldNode, newNode)
+			if err != nil {
+				return nil, err
+			}
+			if !same {
+				changes = append(changes, compareHash)
+			}
+		}
+	}
+	return changes, nil
+}
+
+func sameContent(oldNode, newNode *node) (bool, error) {
+	oldSum, err := fileHash(oldNode.src, oldNode.srcName)
+	if err != nil {
+		return false, err
+	}
+	newSum, err := fileHash(newNode.src, newNode.srcName)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(oldSum, newSum), nil
+}
+
+func fileHash(fsys fs.FS, name string) ([]byte, error) {
+	file, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// renderDiffReport prints how many entries were added, removed and changed.
+func renderDiffReport(out io.Writer, root *node) error {
+	counts := map[string]int{}
+	countStatuses(root.Children, counts)
+	_, err := fmt.Fprintf(out, "\n%d added, %d removed, %d changed\n",
+		counts[statusAdded], counts[statusRemoved], counts[statusChanged])
+	return err
+}
+
+func countStatuses(nodes []*node, counts map[string]int) {
+	for _, n := range nodes {
+		counts[n.Status]++
+		countStatuses(n.Children, counts)
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testDiffResult = `├───project
+│	├───file.txt (19b) [changed: hash]
+│	└───gopher.png (70372b)
+├───static
+│	├───a_lorem
+│	│	├───dolor.txt (empty)
+│	│	├───gopher.png (70372b)
+│	│	└───ipsum
+│	│		└───gopher.png (70372b)
+│	├───css
+│	│	└───body.css (31b) [changed: size, hash]
+│	├───empty.txt (empty)
+│	├───html
+│	│	└───index.html (57b)
+│	├───js (2b) [changed: type]
+│	│	└───site.js (10b) [removed]
+│	├───new.txt (3b) [added]
+│	└───z_lorem
+│		├───dolor.txt (empty)
+│		├───gopher.png (70372b)
+│		└───ipsum
+│			└───gopher.png (70372b)
+├───zline
+│	├───empty.txt (empty)
+│	└───lorem
+│		├───dolor.txt (empty)
+│		├───gopher.png (70372b)
+│		└───ipsum [removed]
+│			└───gopher.png (70372b) [removed]
+└───zzfile.txt [changed: type]
+	└───inner.txt (empty) [added]
+
+2 added, 3 removed, 4 changed
+`
+
+func TestTreeDiff(t *testing.T) {
+	oldRoot, newRoot := t.TempDir(), t.TempDir()
+	copyTree(t, "testdata", oldRoot)
+	copyTree(t, "testdata", newRoot)
+
+	writeFile(t, filepath.Join(newRoot, "project", "file.txt"), "same size, new text")
+	writeFile(t, filepath.Join(newRoot, "static", "css", "body.css"), "body { color: red; width: 1px }")
+	writeFile(t, filepath.Join(newRoot, "static", "new.txt"), "new")
+	if err := os.RemoveAll(filepath.Join(newRoot, "zline", "lorem", "ipsum")); err != nil {
+		t.Fatalf("cant remove: %s", err)
+	}
+	if err := os.Remove(filepath.Join(newRoot, "zzfile.txt")); err != nil {
+		t.Fatalf("cant remove: %s", err)
+	}
+	if err := os.Mkdir(filepath.Join(newRoot, "zzfile.txt"), 0755); err != nil {
+		t.Fatalf("cant create dir: %s", err)
+	}
+	writeFile(t, filepath.Join(newRoot, "zzfile.txt", "inner.txt"), "")
+	// and the other way round
+	if err := os.RemoveAll(filepath.Join(newRoot, "static", "js")); err != nil {
+		t.Fatalf("cant remove: %s", err)
+	}
+	writeFile(t, filepath.Join(newRoot, "static", "js"), "js")
+
+	out := new(bytes.Buffer)
+	opts := defaultOptions()
+	opts.printFiles = true
+	opts.report = true
+	opts.diffBase = oldRoot
+	opts.compare = compareList{compareSize, compareHash}
+	if err := renderTree(out, newRoot, opts); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if result := out.String(); result != testDiffResult {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", result, testDiffResult)
+	}
+}
+
+func TestTreeDiffMtime(t *testing.T) {
+	oldRoot, newRoot := t.TempDir(), t.TempDir()
+	copyTree(t, "testdata/project", oldRoot)
+	copyTree(t, "testdata/project", newRoot)
+
+	stamp := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, root := range []string{oldRoot, newRoot} {
+		for _, name := range []string{"file.txt", "gopher.png"} {
+			if err := os.Chtimes(filepath.Join(root, name), stamp, stamp); err != nil {
+				t.Fatalf("cant set mtime: %s", err)
+			}
+		}
+	}
+	later := stamp.Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(newRoot, "gopher.png"), later, later); err != nil {
+		t.Fatalf("cant set mtime: %s", err)
+	}
+
+	out := new(bytes.Buffer)
+	opts := defaultOptions()
+	opts.printFiles = true
+	opts.diffBase = oldRoot
+	if err := renderTree(out, newRoot, opts); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := "├───file.txt (19b)\n└───gopher.png (70372b) [changed: mtime]\n"
+	if result := out.String(); result != expected {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", result, expected)
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+const gitignoreName = ".gitignore"
+
+// patternList is a repeatable flag of glob patterns.
+type patternList []string
+
+func (p *patternList) String() string {
+	return strings.Join(*p, ",")
+}
+
+func (p *patternList) Set(value string) error {
+	if _, err := path.Match(value, ""); err != nil {
+		return err
+	}
+	*p = append(*p, value)
+	return nil
+}
+
+// ignoreRule is one line of a .gitignore file. base is the directory of
+// that file relative to the walk root, "" for the root itself.
+type ignoreRule struct {
+	base     string
+	pattern  string
+	negate   bool
+	dirOnly  bool
+	anchored bool
+}
+
+func (r ignoreRule) match(rel string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+	if r.base != "" {
+		if !strings.HasPrefix(rel, r.base+"/") {
+			return false
+		}
+		rel = rel[len(r.base)+1:]
+	}
+	if r.anchored {
+		return matchPath(r.pattern, rel)
+	}
+	return matchPath(r.pattern, path.Base(rel))
+}
+
+// filter decides which entries are pruned from the walk.
+type filter struct {
+	exclude patternList
+	include patternList
+	rules   []ignoreRule
+}
+
+// skip reports whether the entry at rel (slash separated, relative to
+// the walk root) is left out. Directories that are skipped are never read.
+func (f filter) skip(rel string, isDir bool) bool {
+	for _, pattern := range f.exclude {
+		if matchName(pattern, rel) {
+			return true
+		}
+	}
+	if !isDir && len(f.include) > 0 {
+		included := false
+		for _, pattern := range f.include {
+			if matchName(pattern, rel) {
+				included = true
+				break
+			}
+		}
+		if !included {
+			return true
+		}
+	}
+	// the last matching rule wins, deeper .gitignore files come last
+	ignored := false
+	for _, rule := range f.rules {
+		if rule.match(rel, isDir) {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
+
+// withGitignore returns a copy of f extended with the rules of the
+// .gitignore file in dir of fsys, if there is one.
+func (f filter) withGitignore(fsys fs.FS, dir, rel string) (filter, error) {
+	file, err := fsys.Open(path.Join(dir, gitignoreName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return f, nil
+	}
+	if err != nil {
+		return f, err
+	}
+	defer file.Close()
+
+	rules := f.rules[:len(f.rules):len(f.rules)]
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if rule, ok := parseIgnoreRule(rel, scanner.Text()); ok {
+			rules = append(rules, rule)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return f, err
+	}
+	f.rules = rules
+	return f, nil
+}
+
+func parseIgnoreRule(base, line string) (ignoreRule, bool) {
+	line = strings.TrimRight(line, " \r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignoreRule{}, false
+	}
+	rule := ignoreRule{base: base}
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	}
+	line = strings.TrimPrefix(line, "\\")
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if strings.Contains(line, "/") {
+		rule.anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+	if line == "" {
+		return ignoreRule{}, false
+	}
+	if _, err := path.Match(line, ""); err != nil {
+		return ignoreRule{}, false
+	}
+	rule.pattern = line
+	return rule, true
+}
+
+// matchName matches a command line pattern: patterns with a slash are
+// matched against the whole relative path, others against the base name.
+func matchName(pattern, rel string) bool {
+	if strings.Contains(pattern, "/") {
+		return matchPath(strings.TrimPrefix(pattern, "/"), rel)
+	}
+	return matchPath(pattern, path.Base(rel))
+}
+
+// matchPath matches a slash separated path against a glob pattern
+// where a "**" segment stands for any number of directories.
+func matchPath(pattern, name string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			pattern = pattern[1:]
+			if len(pattern) == 0 {
+				return len(name) > 0
+			}
+			for i := range name {
+				if matchSegments(pattern, name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testExcludeResult = `├───project
+│	└───file.txt (19b)
+├───static
+│	├───a_lorem
+│	│	└───dolor.txt (empty)
+│	├───css
+│	│	└───body.css (28b)
+│	├───empty.txt (empty)
+│	├───html
+│	│	└───index.html (57b)
+│	└───js
+│		└───site.js (10b)
+├───zline
+│	└───empty.txt (empty)
+└───zzfile.txt (empty)
+`
+
+func TestTreeExclude(t *testing.T) {
+	out := new(bytes.Buffer)
+	opts := options{
+		printFiles: true,
+		format:     formatText,
+		exclude:    patternList{"*.png", "z_lorem", "zline/lorem", "**/ipsum"},
+	}
+	if err := renderTree(out, "testdata", opts); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if result := out.String(); result != testExcludeResult {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", result, testExcludeResult)
+	}
+}
+
+const testIncludeResult = `├───project
+│	└───gopher.png (70372b)
+├───static
+│	├───a_lorem
+│	│	└───gopher.png (70372b)
+│	├───css
+│	├───html
+│	│	└───index.html (57b)
+│	└───js
+└───zline
+	└───lorem
+		└───gopher.png (70372b)
+`
+
+func TestTreeInclude(t *testing.T) {
+	out := new(bytes.Buffer)
+	opts := options{
+		printFiles: true,
+		format:     formatText,
+		exclude:    patternList{"ipsum", "z_lorem"},
+		include:    patternList{"*.png", "static/html/*"},
+	}
+	if err := renderTree(out, "testdata", opts); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if result := out.String(); result != testIncludeResult {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", result, testIncludeResult)
+	}
+}
+
+const testGitignoreResult = `├───.gitignore (24b)
+├───project
+│	├───.gitignore (13b)
+│	└───gopher.png (70372b)
+├───static
+│	├───.gitignore (15b)
+│	├───a_lorem
+│	│	├───dolor.txt (empty)
+│	│	└───gopher.png (70372b)
+│	├───css
+│	│	└───body.css (28b)
+│	├───empty.txt (empty)
+│	├───html
+│	├───js
+│	└───z_lorem
+│		└───dolor.txt (empty)
+└───zzfile.txt (empty)
+`
+
+// gitignore files are added to a copy of testdata,
+// so the fixtures used by main_test.go stay untouched
+func TestTreeGitignore(t *testing.T) {
+	root := t.TempDir()
+	copyTree(t, "testdata", root)
+	writeFile(t, filepath.Join(root, ".gitignore"), "# top level\nzline/\n*.js\n")
+	writeFile(t, filepath.Join(root, "project", ".gitignore"), "*.txt\n!*.png\n")
+	writeFile(t, filepath.Join(root, "static", ".gitignore"), "ipsum/\n/html/*\n")
+	writeFile(t, filepath.Join(root, "static", "z_lorem", ".gitignore"), "*\n!dolor.txt\n")
+
+	out := new(bytes.Buffer)
+	opts := options{printFiles: true, format: formatText, gitignore: true}
+	if err := renderTree(out, root, opts); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if result := out.String(); result != testGitignoreResult {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", result, testGitignoreResult)
+	}
+}
+
+func TestMatchPath(t *testing.T) {
+	cases := []struct {
+		pattern, name string
+		match         bool
+	}{
+		{"*.png", "gopher.png", true},
+		{"static/*", "static/css", true},
+		{"static/*", "static/css/body.css", false},
+		{"**/ipsum", "ipsum", true},
+		{"**/ipsum", "static/a_lorem/ipsum", true},
+		{"static/**", "static/a_lorem/ipsum", true},
+		{"static/**", "static", false},
+		{"static/**/gopher.png", "static/gopher.png", true},
+		{"static/**/gopher.png", "static/a_lorem/ipsum/gopher.png", true},
+		{"static/**/gopher.png", "zline/lorem/gopher.png", false},
+	}
+	for _, c := range cases {
+		if got := matchPath(c.pattern, c.name); got != c.match {
+			t.Errorf("matchPath(%q, %q) = %v, expected %v", c.pattern, c.name, got, c.match)
+		}
+	}
+}
+
+func copyTree(t *testing.T, src, dst string) {
+	t.Helper()
+	err := filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if info.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		in, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		out, err := os.Create(target)
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+		_, err = io.Copy(out, in)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("cant copy %s: %s", src, err)
+	}
+}
+
+func writeFile(t *testing.T, path, data string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatalf("cant write %s: %s", path, err)
+	}
+}
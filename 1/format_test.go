@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+const testXMLResult = `<?xml version="1.0" encoding="UTF-8"?>
+<directory name="zline" size="0">
+  <file name="empty.txt" size="0"></file>
+  <directory name="lorem" size="0">
+    <file name="dolor.txt" size="0"></file>
+    <file name="gopher.png" size="70372"></file>
+    <directory name="ipsum" size="0">
+      <file name="gopher.png" size="70372"></file>
+    </directory>
+  </directory>
+</directory>
+`
+
+func TestTreeXML(t *testing.T) {
+	out := new(bytes.Buffer)
+	err := renderTree(out, "testdata/zline", options{printFiles: true, format: formatXML})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if result := out.String(); result != testXMLResult {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", result, testXMLResult)
+	}
+}
+
+func TestTreeJSON(t *testing.T) {
+	out := new(bytes.Buffer)
+	err := renderTree(out, "testdata", options{printFiles: false, format: formatJSON})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	root := &node{}
+	if err := json.Unmarshal(out.Bytes(), root); err != nil {
+		t.Fatalf("cant unpack result json: %s", err)
+	}
+
+	// the same tree rendered as text must match the plain dirTree output
+	text := new(bytes.Buffer)
+	if err := renderText(text, root, options{}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if result := text.String(); result != testDirResult {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", result, testDirResult)
+	}
+}
+
+func TestParseArgs(t *testing.T) {
+	cases := []struct {
+		args    []string
+		path    string
+		set     func(opts *options)
+		wantErr bool
+	}{
+		{args: []string{"."}, path: "."},
+		{args: []string{".", "-f"}, path: ".", set: func(opts *options) {
+			opts.printFiles = true
+		}},
+		{args: []string{"-o", "json", "testdata", "-f"}, path: "testdata", set: func(opts *options) {
+			opts.printFiles = true
+			opts.format = formatJSON
+		}},
+		{args: []string{".", "-j", "8"}, path: ".", set: func(opts *options) {
+			opts.workers = 8
+		}},
+		{args: []string{"diff", "old", "new", "--compare", "hash"}, path: "new", set: func(opts *options) {
+			opts.diffBase = "old"
+			opts.compare = compareList{compareHash}
+		}},
+		{args: []string{".", "-j", "0"}, wantErr: true},
+		{args: []string{".", "-o", "yaml"}, wantErr: true},
+		{args: []string{".", "--compare", "color"}, wantErr: true},
+		{args: []string{".", "testdata"}, wantErr: true},
+		{args: []string{}, wantErr: true},
+	}
+	for _, c := range cases {
+		path, opts, err := parseArgs(c.args)
+		if c.wantErr {
+			if err == nil {
+				t.Errorf("%v: expected error", c.args)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: unexpected error: %s", c.args, err)
+			continue
+		}
+		expected := defaultOptions()
+		if c.set != nil {
+			c.set(&expected)
+		}
+		if path != c.path || !reflect.DeepEqual(opts, expected) {
+			t.Errorf("%v: got %q %+v, expected %q %+v", c.args, path, opts, c.path, expected)
+		}
+	}
+}
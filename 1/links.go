@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+)
+
+const errRecursive = "recursive, not followed"
+
+// ancestry is the chain of directories above the one being read.
+// It is shared between siblings, so pushing never copies.
+type ancestry struct {
+	info   fs.FileInfo
+	parent *ancestry
+}
+
+func (a *ancestry) push(n *node) *ancestry {
+	if n.info == nil {
+		return a
+	}
+	return &ancestry{info: n.info, parent: a}
+}
+
+// contains reports whether info is one of the ancestors.
+// os.SameFile compares device and inode numbers on unix.
+func (a *ancestry) contains(info fs.FileInfo) bool {
+	if info == nil {
+		return false
+	}
+	for ; a != nil; a = a.parent {
+		if os.SameFile(a.info, info) {
+			return true
+		}
+	}
+	return false
+}
+
+// errLabel is the short form of err printed next to the entry.
+func errLabel(err error) string {
+	if errors.Is(err, fs.ErrPermission) {
+		return "permission denied"
+	}
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		return pathErr.Err.Error()
+	}
+	return err.Error()
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// makeLinkTree builds
+//
+//	a/b/up -> ..      (loop back to a)
+//	a/b/file.txt
+//	alias -> a/b      (link to a directory)
+//	dangling -> nowhere
+//	file.txt
+//	flink -> file.txt
+func makeLinkTree(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "a", "b"), 0755); err != nil {
+		t.Fatalf("cant create dir: %s", err)
+	}
+	writeFile(t, filepath.Join(root, "a", "b", "file.txt"), "1234")
+	writeFile(t, filepath.Join(root, "file.txt"), "12")
+	links := map[string]string{
+		"a/b/up":   "..",
+		"alias":    "a/b",
+		"dangling": "nowhere",
+		"flink":    "file.txt",
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(root, name)); err != nil {
+			t.Skipf("symlinks are not supported: %s", err)
+		}
+	}
+	return root
+}
+
+const testLinksResult = `├───a
+│	└───b
+│		├───file.txt (4b)
+│		└───up -> ..
+├───alias -> a/b
+├───dangling -> nowhere
+├───file.txt (2b)
+└───flink -> file.txt
+`
+
+func TestTreeLinks(t *testing.T) {
+	root := makeLinkTree(t)
+	out := new(bytes.Buffer)
+	if err := renderTree(out, root, options{printFiles: true, format: formatText}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if result := out.String(); result != testLinksResult {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", result, testLinksResult)
+	}
+}
+
+const testFollowLinksResult = `├───a
+│	└───b
+│		├───file.txt (4b)
+│		└───up -> .. [recursive, not followed]
+├───alias -> a/b
+│	├───file.txt (4b)
+│	└───up -> ..
+│		└───b [recursive, not followed]
+├───dangling -> nowhere
+├───file.txt (2b)
+└───flink -> file.txt
+`
+
+func TestTreeFollowLinks(t *testing.T) {
+	root := makeLinkTree(t)
+	for _, workers := range []int{1, 4} {
+		out := new(bytes.Buffer)
+		opts := options{printFiles: true, format: formatText, followLinks: true, workers: workers}
+		if err := renderTree(out, root, opts); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if result := out.String(); result != testFollowLinksResult {
+			t.Errorf("results not match with %d workers\nGot:\n%v\nExpected:\n%v", workers, result, testFollowLinksResult)
+		}
+	}
+}
+
+// denyReadDir makes the directories names, or ending with them, unreadable
+func denyReadDir(t *testing.T, names ...string) {
+	t.Helper()
+	origReadDir := readDir
+	readDir = func(fsys fs.FS, name string) ([]fs.DirEntry, error) {
+		for _, denied := range names {
+			if name == denied || strings.HasSuffix(name, "/"+denied) {
+				return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrPermission}
+			}
+		}
+		return origReadDir(fsys, name)
+	}
+	t.Cleanup(func() {
+		readDir = origReadDir
+	})
+}
+
+const testKeepGoingResult = `├───project
+├───static [permission denied]
+└───zline
+	└───lorem
+		└───ipsum [permission denied]
+`
+
+func TestTreeKeepGoing(t *testing.T) {
+	denyReadDir(t, "static", "lorem/ipsum")
+
+	out := new(bytes.Buffer)
+	err := renderTree(out, "testdata", options{format: formatText})
+	if err == nil {
+		t.Errorf("expected permission error without keep-going")
+	}
+
+	for _, workers := range []int{1, 4} {
+		out := new(bytes.Buffer)
+		opts := options{format: formatText, keepGoing: true, workers: workers}
+		if err := renderTree(out, "testdata", opts); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if result := out.String(); result != testKeepGoingResult {
+			t.Errorf("results not match with %d workers\nGot:\n%v\nExpected:\n%v", workers, result, testKeepGoingResult)
+		}
+	}
+}
+
+func TestTreeKeepGoingRoot(t *testing.T) {
+	denyReadDir(t, ".")
+	err := renderTree(new(bytes.Buffer), "testdata", options{format: formatText, keepGoing: true})
+	if err == nil {
+		t.Errorf("expected error for unreadable root")
+	}
+}
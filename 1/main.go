@@ -1,22 +1,128 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"os"
-	"path/filepath"
-	"strings"
 )
 
+const usage = "usage go run main.go [diff old] . [-f] [--compare size,mtime,hash] [-o text|json|xml] [-I pattern] [--include pattern] [--gitignore] [-L depth] [--du] [-h] [--report] [-j workers] [-l] [--keep-going] [--archives]"
+
+type options struct {
+	printFiles  bool
+	format      string
+	exclude     patternList
+	include     patternList
+	gitignore   bool
+	maxDepth    int
+	du          bool
+	human       bool
+	report      bool
+	workers     int
+	followLinks bool
+	keepGoing   bool
+	archives    bool
+	diffBase    string
+	compare     compareList
+}
+
 func main() {
 	out := os.Stdout
-	if !(len(os.Args) == 2 || len(os.Args) == 3) {
-		panic("usage go run main.go . [-f]")
+	path, opts, err := parseArgs(os.Args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	err = renderTree(out, path, opts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func defaultOptions() options {
+	return options{
+		format:  formatText,
+		workers: 1,
+		compare: compareList{compareSize, compareMtime},
+	}
+}
+
+// parseArgs accepts flags both before and after the path,
+// so the original `main.go . -f` form keeps working.
+func parseArgs(args []string) (string, options, error) {
+	opts := defaultOptions()
+	fs := flag.NewFlagSet("tree", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.BoolVar(&opts.printFiles, "f", false, "print files")
+	fs.StringVar(&opts.format, "o", opts.format, "output format: text, json or xml")
+	fs.Var(&opts.exclude, "I", "exclude entries matching the pattern, repeatable")
+	fs.Var(&opts.exclude, "exclude", "same as -I")
+	fs.Var(&opts.include, "include", "list only files matching the pattern, repeatable")
+	fs.BoolVar(&opts.gitignore, "gitignore", false, "honour .gitignore files found while walking")
+	fs.IntVar(&opts.maxDepth, "L", 0, "descend only depth levels deep, 0 for no limit")
+	fs.BoolVar(&opts.du, "du", false, "show the cumulative size of each directory")
+	fs.BoolVar(&opts.human, "h", false, "print sizes in human readable units")
+	fs.BoolVar(&opts.report, "report", false, "print directory and file counts after the text tree")
+	fs.IntVar(&opts.workers, "j", opts.workers, "read directories with this many concurrent workers")
+	fs.BoolVar(&opts.followLinks, "l", false, "follow symbolic links to directories")
+	fs.BoolVar(&opts.keepGoing, "keep-going", false, "mark unreadable directories instead of failing")
+	fs.BoolVar(&opts.archives, "archives", false, "show the contents of zip and tar archives found while walking")
+	fs.Var(&opts.compare, "compare", "what makes files differ in diff mode: size, mtime and/or hash")
+
+	var paths []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return "", opts, fmt.Errorf("%s: %s", usage, err)
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		paths = append(paths, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+	// `diff old new` compares the tree of new against old
+	if len(paths) == 3 && paths[0] == "diff" {
+		opts.diffBase = paths[1]
+		paths = paths[2:]
+	}
+	if len(paths) != 1 {
+		return "", opts, errors.New(usage)
+	}
+	if opts.workers < 1 {
+		return "", opts, fmt.Errorf("%s: workers must be >= 1", usage)
+	}
+	if opts.maxDepth < 0 {
+		return "", opts, fmt.Errorf("%s: depth must be >= 0", usage)
+	}
+	if _, ok := renderers[opts.format]; !ok {
+		return "", opts, fmt.Errorf("%s: unknown format %q", usage, opts.format)
+	}
+	return paths[0], opts, nil
+}
+
+func dirTree(out io.Writer, path string, printFiles bool) error {
+	opts := defaultOptions()
+	opts.printFiles = printFiles
+	return renderTree(out, path, opts)
+}
+
+func renderTree(out io.Writer, path string, opts options) error {
+	render, ok := renderers[opts.format]
+	if !ok {
+		return fmt.Errorf("unknown format %q", opts.format)
+	}
+	var root *node
+	var err error
+	if opts.diffBase != "" {
+		root, err = diffTrees(opts.diffBase, path, opts)
+	} else {
+		root, err = walkTree(path, opts)
 	}
-	path := os.Args[1]
-	printFiles := len(os.Args) == 3 && os.Args[2] == "-f"
-	err := dirTree(out, path, printFiles)
 	if err != nil {
-		panic(err.Error())
+		return err
 	}
+	return render(out, root, opts)
 }
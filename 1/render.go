@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	formatText = "text"
+	formatJSON = "json"
+	formatXML  = "xml"
+)
+
+type renderFunc func(out io.Writer, root *node, opts options) error
+
+var renderers = map[string]renderFunc{
+	formatText: renderText,
+	formatJSON: renderJSON,
+	formatXML:  renderXML,
+}
+
+// renderText prints the children of root with box-drawing glyphs;
+// the root itself is not printed.
+func renderText(out io.Writer, root *node, opts options) error {
+	if err := renderTextLevel(out, root.Children, "", opts); err != nil {
+		return err
+	}
+	if opts.report && opts.diffBase != "" {
+		return renderDiffReport(out, root)
+	}
+	if opts.report {
+		return renderReport(out, root, opts)
+	}
+	return nil
+}
+
+func renderTextLevel(out io.Writer, nodes []*node, prefix string, opts options) error {
+	for i, n := range nodes {
+		glyph, indent := "├───", "│\t"
+		if i == len(nodes)-1 {
+			glyph, indent = "└───", "\t"
+		}
+		if _, err := fmt.Fprintf(out, "%s%s%s\n", prefix, glyph, textLabel(n, opts)); err != nil {
+			return err
+		}
+		// a file that was a directory in diff mode has children too
+		if len(n.Children) > 0 {
+			if err := renderTextLevel(out, n.Children, prefix+indent, opts); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func textLabel(n *node, opts options) string {
+	label := n.Name
+	if n.Target != "" {
+		label += " -> " + n.Target
+	}
+	if n.Type == typeFile || n.Type == typeArchive || n.isDir() && opts.du {
+		label += " (" + sizeLabel(n.Size, opts.human) + ")"
+	}
+	if n.Error != "" {
+		label += " [" + n.Error + "]"
+	}
+	if n.Status != "" {
+		label += " [" + n.Status
+		if len(n.Changes) > 0 {
+			label += ": " + strings.Join(n.Changes, ", ")
+		}
+		label += "]"
+	}
+	return label
+}
+
+func sizeLabel(size int64, human bool) string {
+	if size == 0 {
+		return "empty"
+	}
+	if !human || size < 1024 {
+		return fmt.Sprintf("%db", size)
+	}
+	value := float64(size)
+	unit := ""
+	for _, u := range []string{"K", "M", "G", "T", "P"} {
+		value /= 1024
+		unit = u
+		if value < 1024 {
+			break
+		}
+	}
+	return fmt.Sprintf("%.1f%s", value, unit)
+}
+
+// renderReport prints the summary line the way tree does it.
+func renderReport(out io.Writer, root *node, opts options) error {
+	dirs, files := countNodes(root.Children)
+	report := plural(dirs, "directory", "directories")
+	if opts.printFiles {
+		report += ", " + plural(files, "file", "files")
+	}
+	_, err := fmt.Fprintf(out, "\n%s\n", report)
+	return err
+}
+
+func countNodes(nodes []*node) (dirs, files int) {
+	for _, n := range nodes {
+		if !n.isDir() {
+			files++
+			continue
+		}
+		dirs++
+		subDirs, subFiles := countNodes(n.Children)
+		dirs += subDirs
+		files += subFiles
+	}
+	return dirs, files
+}
+
+func plural(n int, one, many string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, one)
+	}
+	return fmt.Sprintf("%d %s", n, many)
+}
+
+func renderJSON(out io.Writer, root *node, _ options) error {
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(root)
+}
+
+func renderXML(out io.Writer, root *node, _ options) error {
+	if _, err := io.WriteString(out, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(out)
+	enc.Indent("", "  ")
+	if err := enc.Encode(root); err != nil {
+		return err
+	}
+	_, err := io.WriteString(out, "\n")
+	return err
+}
+
+// MarshalXML writes n as <directory> or <file> element, so the document
+// reads like the tree itself.
+func (n *node) MarshalXML(enc *xml.Encoder, start xml.StartElement) error {
+	start.Name = xml.Name{Local: n.Type}
+	start.Attr = []xml.Attr{
+		{Name: xml.Name{Local: "name"}, Value: n.Name},
+		{Name: xml.Name{Local: "size"}, Value: fmt.Sprint(n.Size)},
+	}
+	if n.Target != "" {
+		start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: "target"}, Value: n.Target})
+	}
+	if n.Error != "" {
+		start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: "error"}, Value: n.Error})
+	}
+	if n.Status != "" {
+		start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: "status"}, Value: n.Status})
+	}
+	if len(n.Changes) > 0 {
+		changes := strings.Join(n.Changes, ",")
+		start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: "changes"}, Value: changes})
+	}
+	if err := enc.EncodeToken(start); err != nil {
+		return err
+	}
+	for _, child := range n.Children {
+		if err := enc.Encode(child); err != nil {
+			return err
+		}
+	}
+	return enc.EncodeToken(start.End())
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+const testDepthDuResult = `├───project (70391b)
+├───static (281583b)
+├───zline (140744b)
+└───zzfile.txt (empty)
+
+3 directories, 1 file
+`
+
+func TestTreeDepthDu(t *testing.T) {
+	out := new(bytes.Buffer)
+	opts := options{printFiles: true, format: formatText, maxDepth: 1, du: true, report: true}
+	if err := renderTree(out, "testdata", opts); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if result := out.String(); result != testDepthDuResult {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", result, testDepthDuResult)
+	}
+}
+
+const testDepthHumanResult = `├───project
+│	├───file.txt (19b)
+│	└───gopher.png (68.7K)
+├───static
+│	├───a_lorem
+│	├───css
+│	├───empty.txt (empty)
+│	├───html
+│	├───js
+│	└───z_lorem
+├───zline
+│	├───empty.txt (empty)
+│	└───lorem
+└───zzfile.txt (empty)
+
+9 directories, 5 files
+`
+
+func TestTreeDepthHuman(t *testing.T) {
+	out := new(bytes.Buffer)
+	opts := options{printFiles: true, format: formatText, maxDepth: 2, human: true, report: true}
+	if err := renderTree(out, "testdata", opts); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if result := out.String(); result != testDepthHumanResult {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", result, testDepthHumanResult)
+	}
+}
+
+func TestTreeReport(t *testing.T) {
+	out := new(bytes.Buffer)
+	opts := options{printFiles: false, format: formatText, report: true}
+	if err := renderTree(out, "testdata", opts); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := testDirResult + "\n12 directories\n"
+	if result := out.String(); result != expected {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", result, expected)
+	}
+}
+
+func TestTreeDuJSON(t *testing.T) {
+	root, err := walkTree("testdata", options{du: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if root.Size != 492718 {
+		t.Errorf("wrong total size\nGot: %d\nExpected: %d", root.Size, 492718)
+	}
+	// files are summed but not listed without -f
+	for _, child := range root.Children {
+		if !child.isDir() {
+			t.Errorf("unexpected file %s", child.Name)
+		}
+	}
+}
+
+func TestSizeLabel(t *testing.T) {
+	cases := []struct {
+		size     int64
+		human    bool
+		expected string
+	}{
+		{0, true, "empty"},
+		{1023, true, "1023b"},
+		{70372, false, "70372b"},
+		{70372, true, "68.7K"},
+		{5 << 20, true, "5.0M"},
+		{3 << 30, true, "3.0G"},
+	}
+	for _, c := range cases {
+		if got := sizeLabel(c.size, c.human); got != c.expected {
+			t.Errorf("sizeLabel(%d, %v) = %q, expected %q", c.size, c.human, got, c.expected)
+		}
+	}
+}
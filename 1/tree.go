@@ -0,0 +1,255 @@
+package main
+
+import (
+	"io/fs"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+const (
+	typeDir     = "directory"
+	typeFile    = "file"
+	typeLink    = "link"
+	typeArchive = "archive"
+)
+
+// readDir is a variable so tests can simulate unreadable directories.
+var readDir = fs.ReadDir
+
+// node is one entry of the walked tree. Every output format is rendered
+// from the same nodes, so they always agree on contents and order.
+type node struct {
+	Name     string   `json:"name"`
+	Type     string   `json:"type"`
+	Size     int64    `json:"size"`
+	Target   string   `json:"target,omitempty"`
+	Error    string   `json:"error,omitempty"`
+	Status   string   `json:"status,omitempty"`
+	Changes  []string `json:"changes,omitempty"`
+	Children []*node  `json:"children,omitempty"`
+
+	// info of a directory is kept for loop detection with -l
+	info    fs.FileInfo
+	dirLink bool
+
+	// where a file came from, to compare it in diff mode
+	src     fs.FS
+	srcName string
+	modTime time.Time
+}
+
+// isDir reports whether n has children: a directory or an expanded archive.
+func (n *node) isDir() bool {
+	return n.Type == typeDir || n.Type == typeArchive
+}
+
+// withinDepth reports whether entries at the given level below the root
+// are shown. The root's own entries are at level 1.
+func (opts options) withinDepth(level int) bool {
+	return opts.maxDepth <= 0 || level <= opts.maxDepth
+}
+
+// descend reports whether a directory at the given level has to be read.
+// In du mode directories past the depth limit are still read to sum
+// their sizes.
+func (opts options) descend(level int) bool {
+	return opts.du || opts.withinDepth(level+1)
+}
+
+// readFiles reports whether files are needed at all: they are either
+// printed or summed for du.
+func (opts options) readFiles() bool {
+	return opts.printFiles || opts.du
+}
+
+// walkTree reads path recursively and returns it as a node tree.
+// Entries come out sorted by name, as fs.ReadDir returns them.
+// An archive given as path is walked like a directory.
+func walkTree(root string, opts options) (*node, error) {
+	fsys, err := rootFS(root)
+	if err != nil {
+		return nil, err
+	}
+	tree := &node{Name: filepath.Base(root), Type: typeDir}
+	if opts.followLinks {
+		if tree.info, err = fs.Stat(fsys, "."); err != nil {
+			return nil, err
+		}
+	}
+	f := filter{exclude: opts.exclude, include: opts.include}
+	if opts.workers > 1 {
+		err = walkConcurrent(tree, fsys, f, opts)
+	} else {
+		err = walkDir(tree, fsys, ".", "", 0, f, nil, opts)
+	}
+	if err != nil {
+		return nil, err
+	}
+	settle(tree, 0, opts)
+	return tree, nil
+}
+
+// walkDir reads the directory dir of fsys into parent. rel is the slash
+// separated path of dir relative to the walk root, depth is its level
+// below the root and up holds the directories above it.
+func walkDir(parent *node, fsys fs.FS, dir, rel string, depth int, f filter, up *ancestry, opts options) error {
+	f, err := readLevel(parent, fsys, dir, rel, f, opts)
+	if err != nil {
+		return err
+	}
+	up = up.push(parent)
+	for _, child := range parent.Children {
+		if !enterDir(child, depth+1, up, opts) {
+			continue
+		}
+		subFS, subDir, err := childDir(fsys, dir, child, opts)
+		if err != nil {
+			return err
+		}
+		if subFS == nil {
+			continue
+		}
+		err = walkDir(child, subFS, subDir, path.Join(rel, child.Name), depth+1, f, up, opts)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// enterDir reports whether child has to be read. A directory that is
+// already one of its own ancestors is marked instead of being entered.
+func enterDir(child *node, level int, up *ancestry, opts options) bool {
+	if !child.isDir() || child.Error != "" || !opts.descend(level) {
+		return false
+	}
+	if opts.followLinks && up.contains(child.info) {
+		child.Error = errRecursive
+		return false
+	}
+	return true
+}
+
+// childDir returns where the contents of child live: the same file
+// system for directories, the opened archive for archives. A nil file
+// system means child was marked with an error in keep-going mode.
+func childDir(fsys fs.FS, dir string, child *node, opts options) (fs.FS, string, error) {
+	name := path.Join(dir, child.Name)
+	if child.Type != typeArchive {
+		return fsys, name, nil
+	}
+	subFS, err := openArchive(fsys, name)
+	if err != nil {
+		if !opts.keepGoing {
+			return nil, "", err
+		}
+		child.Error = errLabel(err)
+		return nil, "", nil
+	}
+	return subFS, ".", nil
+}
+
+// readLevel fills parent.Children with the entries of dir that pass the
+// filter, without descending. It returns the filter for the subdirectories.
+// In keep-going mode an unreadable directory below the root is marked
+// with its error instead of failing the walk.
+func readLevel(parent *node, fsys fs.FS, dir, rel string, f filter, opts options) (filter, error) {
+	entries, err := readDir(fsys, dir)
+	if err == nil && opts.gitignore {
+		f, err = f.withGitignore(fsys, dir, rel)
+	}
+	if err != nil {
+		if !opts.keepGoing || rel == "" {
+			return f, err
+		}
+		parent.Error = errLabel(err)
+		return f, nil
+	}
+	for _, entry := range entries {
+		childRel := path.Join(rel, entry.Name())
+		// symlinks are filtered once their target is known
+		isLink := entry.Type()&fs.ModeSymlink != 0
+		isArchive := opts.archives && entry.Type().IsRegular() && archiveKind(entry.Name()) != ""
+		if !isLink && f.skip(childRel, entry.IsDir()) {
+			continue
+		}
+		if !isLink && !isArchive && !entry.IsDir() && !opts.readFiles() {
+			continue
+		}
+		child, err := entryNode(fsys, entry, path.Join(dir, entry.Name()), opts)
+		if err != nil {
+			if !opts.keepGoing {
+				return f, err
+			}
+			child.Error = errLabel(err)
+		}
+		if isLink && (f.skip(childRel, child.dirLink) || !child.dirLink && !opts.readFiles()) {
+			continue
+		}
+		if isArchive {
+			child.Type = typeArchive
+		}
+		parent.Children = append(parent.Children, child)
+	}
+	return f, nil
+}
+
+// entryNode describes one directory entry. Symlinks become links that
+// show their target, or directories when -l follows them.
+func entryNode(fsys fs.FS, entry fs.DirEntry, name string, opts options) (*node, error) {
+	child := &node{Name: entry.Name(), Type: typeDir}
+	if entry.Type()&fs.ModeSymlink != 0 {
+		child.Type = typeLink
+		if lfs, ok := fsys.(linkFS); ok {
+			target, err := lfs.ReadLink(name)
+			if err != nil {
+				return child, err
+			}
+			child.Target = target
+		}
+		info, err := fs.Stat(fsys, name)
+		if err != nil || !info.IsDir() {
+			// dangling links and links to files are shown as they are
+			return child, nil
+		}
+		child.dirLink = true
+		if opts.followLinks {
+			child.Type = typeDir
+			child.info = info
+		}
+		return child, nil
+	}
+	info, err := entry.Info()
+	if err != nil {
+		child.Type = typeFile
+		return child, err
+	}
+	if !entry.IsDir() {
+		child.Type = typeFile
+		child.Size = info.Size()
+		child.src, child.srcName, child.modTime = fsys, name, info.ModTime()
+	} else if opts.followLinks {
+		child.info = info
+	}
+	return child, nil
+}
+
+// settle sums directory sizes in du mode and drops the entries that are
+// not shown: files without -f and everything below the depth limit.
+func settle(n *node, depth int, opts options) {
+	visible := n.Children[:0]
+	for _, child := range n.Children {
+		if child.isDir() {
+			settle(child, depth+1, opts)
+		}
+		// an archive keeps its own size on disk, not the unpacked one
+		if opts.du && n.Type != typeArchive {
+			n.Size += child.Size
+		}
+		if opts.withinDepth(depth+1) && (child.isDir() || child.dirLink || opts.printFiles) {
+			visible = append(visible, child)
+		}
+	}
+	n.Children = visible
+}
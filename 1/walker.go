@@ -0,0 +1,121 @@
+package main
+
+import (
+	"io/fs"
+	"path"
+	"sync"
+)
+
+// dirTask is a directory waiting to be read by the concurrent walker.
+type dirTask struct {
+	node  *node
+	fsys  fs.FS
+	dir   string
+	rel   string
+	depth int
+	f     filter
+	up    *ancestry
+}
+
+// walker reads directories with a fixed number of workers. Every task
+// fills the Children of its own node, so the tree keeps the sorted order
+// of the sequential walk no matter which worker finishes first.
+type walker struct {
+	opts options
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	queue   []dirTask
+	pending int
+	err     error
+}
+
+func walkConcurrent(root *node, fsys fs.FS, f filter, opts options) error {
+	w := &walker{opts: opts}
+	w.cond = sync.NewCond(&w.mu)
+	w.queue = append(w.queue, dirTask{node: root, fsys: fsys, dir: ".", f: f})
+	w.pending = 1
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < opts.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.work()
+		}()
+	}
+	wg.Wait()
+	return w.err
+}
+
+func (w *walker) work() {
+	for {
+		task, ok := w.next()
+		if !ok {
+			return
+		}
+		subTasks, err := w.read(task)
+		w.done(subTasks, err)
+	}
+}
+
+// next blocks until there is a task to run. It returns false once the
+// walk is finished or has failed.
+func (w *walker) next() (dirTask, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for len(w.queue) == 0 && w.pending > 0 && w.err == nil {
+		w.cond.Wait()
+	}
+	if w.pending == 0 || w.err != nil {
+		return dirTask{}, false
+	}
+	task := w.queue[len(w.queue)-1]
+	w.queue = w.queue[:len(w.queue)-1]
+	return task, true
+}
+
+func (w *walker) done(subTasks []dirTask, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.pending--
+	if err != nil && w.err == nil {
+		w.err = err
+	}
+	if w.err == nil {
+		w.queue = append(w.queue, subTasks...)
+		w.pending += len(subTasks)
+	}
+	w.cond.Broadcast()
+}
+
+func (w *walker) read(task dirTask) ([]dirTask, error) {
+	f, err := readLevel(task.node, task.fsys, task.dir, task.rel, task.f, w.opts)
+	if err != nil {
+		return nil, err
+	}
+	up := task.up.push(task.node)
+	var subTasks []dirTask
+	for _, child := range task.node.Children {
+		if !enterDir(child, task.depth+1, up, w.opts) {
+			continue
+		}
+		subFS, subDir, err := childDir(task.fsys, task.dir, child, w.opts)
+		if err != nil {
+			return nil, err
+		}
+		if subFS == nil {
+			continue
+		}
+		subTasks = append(subTasks, dirTask{
+			node:  child,
+			fsys:  subFS,
+			dir:   subDir,
+			rel:   path.Join(task.rel, child.Name),
+			depth: task.depth + 1,
+			f:     f,
+			up:    up,
+		})
+	}
+	return subTasks, nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWalkConcurrentOrder(t *testing.T) {
+	cases := []options{
+		{printFiles: true},
+		{printFiles: false},
+		{printFiles: true, du: true, maxDepth: 2},
+		{printFiles: true, exclude: patternList{"ipsum", "*.txt"}},
+	}
+	for _, opts := range cases {
+		opts.format = formatText
+		opts.workers = 1
+		expected := new(bytes.Buffer)
+		if err := renderTree(expected, "testdata", opts); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		opts.workers = 4
+		for i := 0; i < 20; i++ {
+			result := new(bytes.Buffer)
+			if err := renderTree(result, "testdata", opts); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if result.String() != expected.String() {
+				t.Fatalf("results not match for %+v\nGot:\n%v\nExpected:\n%v", opts, result, expected)
+			}
+		}
+	}
+}
+
+func TestWalkConcurrentDeep(t *testing.T) {
+	root := t.TempDir()
+	makeDeepTree(t, root, 3, 4, 3)
+
+	sequential, err := walkTree(root, options{printFiles: true, du: true, workers: 1})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	concurrent, err := walkTree(root, options{printFiles: true, du: true, workers: 8})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(sequential, concurrent) {
+		t.Errorf("concurrent walk differs from sequential one")
+	}
+}
+
+func TestWalkConcurrentError(t *testing.T) {
+	_, err := walkTree("testdata/missing", options{printFiles: true, workers: 4})
+	if err == nil {
+		t.Errorf("expected error for missing directory")
+	}
+}
+
+// makeDeepTree creates depth levels of fanout directories,
+// each of them holding files small files.
+func makeDeepTree(tb testing.TB, dir string, depth, fanout, files int) {
+	tb.Helper()
+	for i := 0; i < files; i++ {
+		data := strings.Repeat("x", i*10)
+		err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("file%d.txt", i)), []byte(data), 0644)
+		if err != nil {
+			tb.Fatalf("cant create file: %s", err)
+		}
+	}
+	if depth == 0 {
+		return
+	}
+	for i := 0; i < fanout; i++ {
+		sub := filepath.Join(dir, fmt.Sprintf("dir%d", i))
+		if err := os.Mkdir(sub, 0755); err != nil {
+			tb.Fatalf("cant create dir: %s", err)
+		}
+		makeDeepTree(tb, sub, depth-1, fanout, files)
+	}
+}
+
+// go test -bench Walk -benchmem
+
+func benchmarkWalk(b *testing.B, workers int) {
+	root := b.TempDir()
+	makeDeepTree(b, root, 4, 6, 5)
+	opts := options{printFiles: true, workers: workers}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := walkTree(root, opts); err != nil {
+			b.Fatalf("unexpected error: %s", err)
+		}
+	}
+}
+
+func BenchmarkWalkSequential(b *testing.B) {
+	benchmarkWalk(b, 1)
+}
+
+func BenchmarkWalkConcurrent4(b *testing.B) {
+	benchmarkWalk(b, 4)
+}
+
+func BenchmarkWalkConcurrent16(b *testing.B) {
+	benchmarkWalk(b, 16)
+}
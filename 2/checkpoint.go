@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+)
+
+// CheckpointStore keeps the results of a stage by input, so a rerun
+// of the pipeline does not compute them again.
+type CheckpointStore interface {
+	Load(stage, key string) (value string, ok bool)
+	Save(stage, key, value string)
+}
+
+// CheckpointedSigner returns the SingleHash -> MultiHash -> CombineResults
+// jobs. The hashes are looked up in store first and saved there once
+// computed, so CombineResults sends the same result as without store.
+func CheckpointedSigner(store CheckpointStore) []job {
+	return DefaultHasher.Checkpointed(store)
+}
+
+// Checkpointed is CheckpointedSigner over the signers of h. Results
+// are kept apart by the signers, like "SingleHash(md5,crc32)".
+func (h Hasher) Checkpointed(store CheckpointStore) []job {
+	single := checkpoint(store, "SingleHash("+h.String()+")", h.single)
+	multi := checkpoint(store, "MultiHash("+h.String()+")", h.multi)
+	return []job{
+		func(in, out chan interface{}) { hashEach(in, out, single) },
+		func(in, out chan interface{}) { hashEach(in, out, multi) },
+		CombineResults,
+	}
+}
+
+// checkpoint wraps hash of a stage with store. The salt is part of the
+// key: results computed with another one are not valid.
+func checkpoint(store CheckpointStore, stage string, hash func(string) string) func(string) string {
+	return func(data string) string {
+		key := DataSignerSalt + "\x00" + data
+		if value, ok := store.Load(stage, key); ok {
+			return value
+		}
+		value := hash(data)
+		store.Save(stage, key, value)
+		return value
+	}
+}
+
+type checkpointKey struct {
+	stage, key string
+}
+
+// MemStore is a CheckpointStore living as long as the process.
+type MemStore struct {
+	mu      sync.Mutex
+	results map[checkpointKey]string
+}
+
+// Load returns the saved result of key in stage.
+func (s *MemStore) Load(stage, key string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	value, ok := s.results[checkpointKey{stage, key}]
+	return value, ok
+}
+
+// Save keeps the result of key in stage.
+func (s *MemStore) Save(stage, key, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.results == nil {
+		s.results = map[checkpointKey]string{}
+	}
+	s.results[checkpointKey{stage, key}] = value
+}
+
+// checkpointRecord is a line of the file of a FileStore.
+type checkpointRecord struct {
+	Stage string `json:"stage"`
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// FileStore is a CheckpointStore appending every result to a file as
+// a JSON line, read back by the next OpenFileStore.
+type FileStore struct {
+	MemStore
+	file *os.File
+	err  error
+}
+
+// OpenFileStore opens or creates the store at path. A last line cut short
+// by a crash is dropped.
+func OpenFileStore(path string) (*FileStore, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	s := &FileStore{file: file}
+	if err := s.load(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// load reads the records and leaves the file positioned after the last
+// complete one.
+func (s *FileStore) load() error {
+	reader := bufio.NewReader(s.file)
+	var good int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		record := checkpointRecord{}
+		if err := json.Unmarshal(bytes.TrimSpace(line), &record); err != nil {
+			return err
+		}
+		s.MemStore.Save(record.Stage, record.Key, record.Value)
+		good += int64(len(line))
+	}
+	if err := s.file.Truncate(good); err != nil {
+		return err
+	}
+	_, err := s.file.Seek(good, io.SeekStart)
+	return err
+}
+
+// Save keeps the result and appends it to the file. A write error is
+// returned by Close.
+func (s *FileStore) Save(stage, key, value string) {
+	line, err := json.Marshal(checkpointRecord{Stage: stage, Key: key, Value: value})
+	if err != nil {
+		s.fail(err)
+		return
+	}
+	s.mu.Lock()
+	if s.results == nil {
+		s.results = map[checkpointKey]string{}
+	}
+	s.results[checkpointKey{stage, key}] = value
+	_, err = s.file.Write(append(line, '\n'))
+	s.mu.Unlock()
+	if err != nil {
+		s.fail(err)
+	}
+}
+
+func (s *FileStore) fail(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err == nil {
+		s.err = err
+	}
+}
+
+// Close closes the file and returns the first error of Save, if any.
+func (s *FileStore) Close() error {
+	err := s.file.Close()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	return err
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"crypto/md5"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+)
+
+// fastSigners replaces the signers with ones that do not sleep
+// and counts the crc32 calls
+func fastSigners(t *testing.T) *uint32 {
+	md5Signer, crc32Signer := DataSignerMd5, DataSignerCrc32
+	t.Cleanup(func() {
+		DataSignerMd5, DataSignerCrc32 = md5Signer, crc32Signer
+	})
+	calls := new(uint32)
+	DataSignerMd5 = func(data string) string {
+		return fmt.Sprintf("%x", md5.Sum([]byte(data+DataSignerSalt)))
+	}
+	DataSignerCrc32 = func(data string) string {
+		atomic.AddUint32(calls, 1)
+		return strconv.FormatUint(uint64(crc32.ChecksumIEEE([]byte(data+DataSignerSalt))), 10)
+	}
+	return calls
+}
+
+// signAll runs the checkpointed signer over inputs and returns the result
+func signAll(store CheckpointStore, inputs ...int) string {
+	var result string
+	jobs := []job{
+		job(func(in, out chan interface{}) {
+			for _, n := range inputs {
+				out <- n
+			}
+		}),
+	}
+	jobs = append(jobs, CheckpointedSigner(store)...)
+	jobs = append(jobs, job(func(in, out chan interface{}) {
+		result = (<-in).(string)
+	}))
+	ExecutePipeline(jobs...)
+	return result
+}
+
+func TestCheckpointResume(t *testing.T) {
+	calls := fastSigners(t)
+	path := filepath.Join(t.TempDir(), "signer.ckpt")
+
+	// what the signer gives without checkpoints
+	expected := signAll(&MemStore{}, 0, 1, 2, 3)
+	atomic.StoreUint32(calls, 0)
+
+	// the first run stops after two values
+	store, err := OpenFileStore(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	signAll(store, 0, 1)
+	if err := store.Close(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if n := atomic.SwapUint32(calls, 0); n != 2*8 {
+		t.Errorf("wrong crc32 calls\nGot: %d\nExpected: %d", n, 2*8)
+	}
+
+	// the rerun only computes the rest
+	store, err = OpenFileStore(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	result := signAll(store, 0, 1, 2, 3)
+	if err := store.Close(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if n := atomic.SwapUint32(calls, 0); n != 2*8 {
+		t.Errorf("wrong crc32 calls\nGot: %d\nExpected: %d", n, 2*8)
+	}
+	if result != expected {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", result, expected)
+	}
+}
+
+func TestCheckpointSalt(t *testing.T) {
+	calls := fastSigners(t)
+	store := &MemStore{}
+	signAll(store, 0)
+
+	salt := DataSignerSalt
+	defer func() { DataSignerSalt = salt }()
+	DataSignerSalt = "other"
+	atomic.StoreUint32(calls, 0)
+	signAll(store, 0)
+	if n := atomic.LoadUint32(calls); n != 8 {
+		t.Errorf("results of another salt reused\nGot: %d calls\nExpected: %d", n, 8)
+	}
+}
+
+// a crash in the middle of a write leaves half a line at the end
+func TestFileStoreTruncatedLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "signer.ckpt")
+	content := `{"stage":"SingleHash","key":"1","value":"a~b"}` + "\n" + `{"stage":"Multi`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	store, err := OpenFileStore(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if value, ok := store.Load("SingleHash", "1"); !ok || value != "a~b" {
+		t.Errorf("wrong value\nGot: %q, %v\nExpected: %q, true", value, ok, "a~b")
+	}
+	store.Save("MultiHash", "a~b", "123")
+	if err := store.Close(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	store, err = OpenFileStore(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer store.Close()
+	if value, ok := store.Load("MultiHash", "a~b"); !ok || value != "123" {
+		t.Errorf("wrong value\nGot: %q, %v\nExpected: %q, true", value, ok, "123")
+	}
+}
+
+func TestFileStoreCorrupted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "signer.ckpt")
+	if err := os.WriteFile(path, []byte("not json\n{}\n"), 0644); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := OpenFileStore(path); err == nil {
+		t.Errorf("expected error for a corrupted store")
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// Backpressure is what a stage does when its output buffer is full.
+type Backpressure int
+
+const (
+	// Block waits for the next stage to take a value.
+	Block Backpressure = iota
+	// DropOldest throws away the oldest buffered value to make room.
+	DropOldest
+	// Fail stops the pipeline with ErrBufferFull.
+	Fail
+)
+
+// ErrBufferFull is returned by ExecutePipelineConfig when a Fail stage
+// finds its output buffer full.
+var ErrBufferFull = errors.New("pipeline buffer is full")
+
+// StageConfig is a job of ExecutePipelineConfig with the way it runs.
+type StageConfig struct {
+	Job contextJob
+	// Buffer is the size of the output channel, MaxInputDataLen if <= 0.
+	Buffer int
+	// Workers is the number of copies of Job sharing the input and
+	// the output, 1 if <= 0.
+	Workers      int
+	Backpressure Backpressure
+	// OnDrop, if set, is called with every value DropOldest throws away.
+	OnDrop func(interface{})
+}
+
+// ExecutePipelineConfig is ExecutePipelineContext with the buffer size,
+// workers and backpressure set per stage. Memory stays bounded by the
+// buffers whatever the length of the input.
+func ExecutePipelineConfig(parent context.Context, stages ...StageConfig) error {
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+
+	var (
+		firstErr error
+		once     sync.Once
+	)
+	fail := func(err error) {
+		once.Do(func() {
+			firstErr = err
+			cancel()
+		})
+	}
+
+	wg := &sync.WaitGroup{}
+	in := make(chan interface{})
+	close(in)
+	for _, s := range stages {
+		out := make(chan interface{}, s.buffer())
+		wg.Add(1)
+		go func(s StageConfig, in <-chan interface{}, out chan interface{}) {
+			defer wg.Done()
+			defer drain(in)
+			defer close(out)
+			s.run(ctx, in, out, fail)
+		}(s, in, out)
+		in = out
+	}
+	// nobody reads the output of the last job
+	wg.Add(1)
+	go func(in <-chan interface{}) {
+		defer wg.Done()
+		drain(in)
+	}(in)
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	return parent.Err()
+}
+
+func (s StageConfig) buffer() int {
+	if s.Buffer <= 0 {
+		return MaxInputDataLen
+	}
+	return s.Buffer
+}
+
+// run runs the workers of s and returns when all of them are done.
+func (s StageConfig) run(ctx context.Context, in <-chan interface{}, out chan interface{}, fail func(error)) {
+	jobOut := out
+	forwarded := make(chan struct{})
+	if s.Backpressure == Block {
+		close(forwarded)
+	} else {
+		// the workers write to jobOut, the forwarder applies
+		// the backpressure on the way to out
+		jobOut = make(chan interface{})
+		go func() {
+			defer close(forwarded)
+			s.forward(jobOut, out, fail)
+		}()
+	}
+
+	workers := s.Workers
+	if workers <= 0 {
+		workers = 1
+	}
+	wg := &sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := s.Job(ctx, in, jobOut); err != nil {
+				fail(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if jobOut != out {
+		close(jobOut)
+	}
+	<-forwarded
+}
+
+// forward moves the values from in to out, which may be full.
+// After a failure it keeps reading in, so the workers are never stuck.
+func (s StageConfig) forward(in <-chan interface{}, out chan interface{}, fail func(error)) {
+	failed := false
+	for v := range in {
+		if !failed && !s.push(v, out) {
+			fail(ErrBufferFull)
+			failed = true
+		}
+	}
+}
+
+// push sends v to out without blocking, dropping the oldest values
+// if needed. It returns false if out is full and s may not drop.
+func (s StageConfig) push(v interface{}, out chan interface{}) bool {
+	for {
+		select {
+		case out <- v:
+			return true
+		default:
+		}
+		if s.Backpressure == Fail {
+			return false
+		}
+		// the next stage may take the oldest value first,
+		// then there is room anyway
+		select {
+		case old := <-out:
+			if s.OnDrop != nil {
+				s.OnDrop(old)
+			}
+		default:
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const payloadSize = 1 << 20
+
+type payload struct {
+	n    int
+	data []byte
+}
+
+// flood sends 1MB payloads numbered from 0 forever
+func flood(produced *int64) contextJob {
+	return func(ctx context.Context, in <-chan interface{}, out chan<- interface{}) error {
+		for i := 0; ; i++ {
+			if err := send(ctx, out, payload{n: i, data: make([]byte, payloadSize)}); err != nil {
+				return err
+			}
+			atomic.AddInt64(produced, 1)
+		}
+	}
+}
+
+// heapAlloc is the heap in use after a collection
+func heapAlloc() uint64 {
+	runtime.GC()
+	stats := &runtime.MemStats{}
+	runtime.ReadMemStats(stats)
+	return stats.HeapAlloc
+}
+
+func TestConfigWorkers(t *testing.T) {
+	checkLeaks(t)
+
+	var sum int64
+	start := time.Now()
+	err := ExecutePipelineConfig(context.Background(),
+		StageConfig{Job: generate(8)},
+		StageConfig{
+			Job: func(ctx context.Context, in <-chan interface{}, out chan<- interface{}) error {
+				for val := range in {
+					time.Sleep(50 * time.Millisecond)
+					atomic.AddInt64(&sum, int64(val.(int)))
+				}
+				return nil
+			},
+			Workers: 4,
+		},
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if sum != 28 {
+		t.Errorf("wrong sum\nGot: %d\nExpected: %d", sum, 28)
+	}
+	if end := time.Since(start); end > 150*time.Millisecond {
+		t.Errorf("execution too long\nGot: %s\nExpected: <%s", end, 150*time.Millisecond)
+	}
+}
+
+// an endless input into a slow consumer: with Block the producer waits,
+// so at most the buffer is in memory
+func TestConfigBlockBounded(t *testing.T) {
+	checkLeaks(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+
+	var produced, consumed, maxInFlight int64
+	var maxHeap uint64
+	baseline := heapAlloc()
+	err := ExecutePipelineConfig(ctx,
+		StageConfig{Job: flood(&produced), Buffer: 4},
+		StageConfig{Job: func(ctx context.Context, in <-chan interface{}, out chan<- interface{}) error {
+			for range in {
+				n := atomic.AddInt64(&consumed, 1)
+				if inFlight := atomic.LoadInt64(&produced) - n; inFlight > maxInFlight {
+					maxInFlight = inFlight
+				}
+				if n%20 == 0 {
+					if heap := heapAlloc(); heap > maxHeap {
+						maxHeap = heap
+					}
+				}
+				time.Sleep(time.Millisecond)
+			}
+			return nil
+		}},
+	)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("wrong error\nGot: %v\nExpected: %v", err, context.DeadlineExceeded)
+	}
+	if consumed == 0 {
+		t.Fatalf("nothing consumed")
+	}
+	if maxInFlight > 5 {
+		t.Errorf("too many values in flight\nGot: %d\nExpected: <=%d", maxInFlight, 5)
+	}
+	if maxHeap > baseline+32*payloadSize {
+		t.Errorf("memory not bounded\nGot: %d\nExpected: <=%d", maxHeap, baseline+32*payloadSize)
+	}
+}
+
+// with DropOldest the producer never waits, the consumer gets the newest
+// values in order and the rest is dropped
+func TestConfigDropOldest(t *testing.T) {
+	checkLeaks(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	var produced, consumed, dropped int64
+	ordered := true
+	var maxHeap uint64
+	baseline := heapAlloc()
+	err := ExecutePipelineConfig(ctx,
+		StageConfig{
+			Job:          flood(&produced),
+			Buffer:       4,
+			Backpressure: DropOldest,
+			OnDrop: func(interface{}) {
+				atomic.AddInt64(&dropped, 1)
+			},
+		},
+		StageConfig{Job: func(ctx context.Context, in <-chan interface{}, out chan<- interface{}) error {
+			last := -1
+			for val := range in {
+				n := atomic.AddInt64(&consumed, 1)
+				if val.(payload).n <= last {
+					ordered = false
+				}
+				last = val.(payload).n
+				if n%20 == 0 {
+					if heap := heapAlloc(); heap > maxHeap {
+						maxHeap = heap
+					}
+				}
+				time.Sleep(5 * time.Millisecond)
+			}
+			return nil
+		}},
+	)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("wrong error\nGot: %v\nExpected: %v", err, context.DeadlineExceeded)
+	}
+	if dropped == 0 || consumed == 0 {
+		t.Fatalf("wrong counts: produced %d, consumed %d, dropped %d", produced, consumed, dropped)
+	}
+	if !ordered {
+		t.Errorf("values not in order")
+	}
+	if maxHeap > baseline+32*payloadSize {
+		t.Errorf("memory not bounded\nGot: %d\nExpected: <=%d", maxHeap, baseline+32*payloadSize)
+	}
+}
+
+func TestConfigFail(t *testing.T) {
+	checkLeaks(t)
+
+	err := ExecutePipelineConfig(context.Background(),
+		StageConfig{Job: generate(0), Buffer: 2, Backpressure: Fail},
+		// never reads until the pipeline is stopped
+		StageConfig{Job: func(ctx context.Context, in <-chan interface{}, out chan<- interface{}) error {
+			<-ctx.Done()
+			return nil
+		}},
+	)
+	if !errors.Is(err, ErrBufferFull) {
+		t.Fatalf("wrong error\nGot: %v\nExpected: %v", err, ErrBufferFull)
+	}
+}
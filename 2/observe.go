@@ -0,0 +1,308 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// latencyBounds are the upper bounds of the latency histogram buckets,
+// the last bucket has none.
+var latencyBounds = []time.Duration{
+	time.Millisecond,
+	10 * time.Millisecond,
+	100 * time.Millisecond,
+	time.Second,
+	10 * time.Second,
+}
+
+// Histogram counts durations by latencyBounds.
+type Histogram struct {
+	Counts []int
+	Count  int
+	Sum    time.Duration
+	Min    time.Duration
+	Max    time.Duration
+}
+
+func (h *Histogram) add(d time.Duration) {
+	if h.Counts == nil {
+		h.Counts = make([]int, len(latencyBounds)+1)
+	}
+	i := sort.Search(len(latencyBounds), func(i int) bool {
+		return d <= latencyBounds[i]
+	})
+	h.Counts[i]++
+	if h.Count == 0 || d < h.Min {
+		h.Min = d
+	}
+	if d > h.Max {
+		h.Max = d
+	}
+	h.Count++
+	h.Sum += d
+}
+
+// Avg is the mean of the durations.
+func (h Histogram) Avg() time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+	return h.Sum / time.Duration(h.Count)
+}
+
+// span is the time one item spent in a job.
+type span struct {
+	start, end time.Time
+}
+
+// JobStats is what an Observer saw of one job. In, Out and MaxQueue
+// are counted on its channels. Latency and the spans of the trace are
+// those of the items the job reported with ObserveItem, as SingleHash
+// and MultiHash do: the values a job writes are not the ones it reads,
+// so the channels cannot tell how long an item took.
+type JobStats struct {
+	Name     string
+	In       int
+	Out      int
+	MaxQueue int
+	Latency  Histogram
+
+	spans []span
+}
+
+// Observer collects the stats and the trace of a pipeline run
+// by ExecutePipelineObserved.
+type Observer struct {
+	mu    sync.Mutex
+	start time.Time
+	jobs  []*JobStats
+}
+
+// ExecutePipelineObserved is ExecutePipeline reporting every job to o.
+func ExecutePipelineObserved(o *Observer, jobs ...job) {
+	observed := make([]job, len(jobs))
+	for i, j := range jobs {
+		observed[i] = o.observe(j)
+	}
+	ExecutePipeline(observed...)
+}
+
+// observedJob is where the items of a job reported by ObserveItem go.
+type observedJob struct {
+	o  *Observer
+	st *JobStats
+}
+
+// observedOuts are the observed jobs by the channel they write to.
+var observedOuts sync.Map
+
+// ObserveItem starts the span of an item of the job writing to out and
+// returns the function ending it. It does nothing for jobs not run by
+// ExecutePipelineObserved.
+func ObserveItem(out chan interface{}) (end func()) {
+	v, ok := observedOuts.Load(out)
+	if !ok {
+		return func() {}
+	}
+	oj := v.(*observedJob)
+	start := time.Now()
+	return func() {
+		oj.o.span(oj.st, start, time.Now())
+	}
+}
+
+// observe wraps j with channels that count every item it reads and writes.
+func (o *Observer) observe(j job) job {
+	o.mu.Lock()
+	st := &JobStats{Name: jobName(j, len(o.jobs))}
+	o.jobs = append(o.jobs, st)
+	o.mu.Unlock()
+
+	return func(in, out chan interface{}) {
+		o.mu.Lock()
+		if o.start.IsZero() {
+			o.start = time.Now()
+		}
+		o.mu.Unlock()
+
+		observedIn := make(chan interface{})
+		observedOut := make(chan interface{})
+		go func() {
+			defer close(observedIn)
+			for v := range in {
+				o.read(st, len(in))
+				observedIn <- v
+			}
+		}()
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for v := range observedOut {
+				o.write(st)
+				out <- v
+			}
+		}()
+
+		observedOuts.Store(observedOut, &observedJob{o: o, st: st})
+		j(observedIn, observedOut)
+		observedOuts.Delete(observedOut)
+		close(observedOut)
+		<-done
+		// let the reader finish if j returned without reading everything
+		drain(observedIn)
+	}
+}
+
+func (o *Observer) read(st *JobStats, queue int) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	st.In++
+	if queue > st.MaxQueue {
+		st.MaxQueue = queue
+	}
+}
+
+func (o *Observer) write(st *JobStats) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	st.Out++
+}
+
+func (o *Observer) span(st *JobStats, start, end time.Time) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	st.Latency.add(end.Sub(start))
+	st.spans = append(st.spans, span{start: start, end: end})
+}
+
+// jobName is the name of the function of j without the package,
+// or "job N" if it has none.
+func jobName(j job, index int) string {
+	f := runtime.FuncForPC(reflect.ValueOf(j).Pointer())
+	if f == nil {
+		return fmt.Sprintf("job %d", index)
+	}
+	name := f.Name()
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	if i := strings.Index(name, "."); i >= 0 {
+		name = name[i+1:]
+	}
+	return name
+}
+
+// Stats returns the stats of every job in pipeline order.
+func (o *Observer) Stats() []JobStats {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	stats := make([]JobStats, len(o.jobs))
+	for i, st := range o.jobs {
+		stats[i] = *st
+		stats[i].Latency.Counts = append([]int(nil), st.Latency.Counts...)
+		stats[i].spans = append([]span(nil), st.spans...)
+	}
+	return stats
+}
+
+// WriteReport prints the counters of every job followed by the latency
+// histogram of its items, if it reported them.
+func (o *Observer) WriteReport(w io.Writer) error {
+	for _, st := range o.Stats() {
+		line := fmt.Sprintf("%s: in %d, out %d, max queue %d", st.Name, st.In, st.Out, st.MaxQueue)
+		if st.Latency.Count == 0 {
+			if _, err := fmt.Fprintln(w, line); err != nil {
+				return err
+			}
+			continue
+		}
+		_, err := fmt.Fprintf(w, "%s, latency avg %s, min %s, max %s\n",
+			line, st.Latency.Avg(), st.Latency.Min, st.Latency.Max)
+		if err != nil {
+			return err
+		}
+		buckets := make([]string, 0, len(st.Latency.Counts))
+		for i, n := range st.Latency.Counts {
+			if i < len(latencyBounds) {
+				buckets = append(buckets, fmt.Sprintf("<=%s %d", latencyBounds[i], n))
+			} else {
+				buckets = append(buckets, fmt.Sprintf(">%s %d", latencyBounds[i-1], n))
+			}
+		}
+		if _, err := fmt.Fprintf(w, "\t%s\n", strings.Join(buckets, " | ")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// traceEvent is an event of the Chrome trace format, times are
+// in microseconds.
+type traceEvent struct {
+	Name  string            `json:"name"`
+	Phase string            `json:"ph"`
+	Time  int64             `json:"ts"`
+	Dur   int64             `json:"dur,omitempty"`
+	Pid   int               `json:"pid"`
+	Tid   int               `json:"tid"`
+	Args  map[string]string `json:"args,omitempty"`
+}
+
+// WriteTrace writes the items every job reported as a Chrome trace,
+// viewable in chrome://tracing or Perfetto. Items of a job processed at
+// the same time go to separate lanes, so the overlap is visible.
+func (o *Observer) WriteTrace(w io.Writer) error {
+	o.mu.Lock()
+	start := o.start
+	o.mu.Unlock()
+
+	events := []traceEvent{}
+	tid := 0
+	for _, st := range o.Stats() {
+		spans := st.spans
+		sort.SliceStable(spans, func(a, b int) bool {
+			return spans[a].start.Before(spans[b].start)
+		})
+		var lanes []time.Time // end of the last span of every lane
+		for i, s := range spans {
+			lane := 0
+			for lane < len(lanes) && lanes[lane].After(s.start) {
+				lane++
+			}
+			if lane == len(lanes) {
+				lanes = append(lanes, time.Time{})
+				events = append(events, traceEvent{
+					Name:  "thread_name",
+					Phase: "M",
+					Pid:   1,
+					Tid:   tid + lane,
+					Args:  map[string]string{"name": fmt.Sprintf("%s #%d", st.Name, lane)},
+				})
+			}
+			lanes[lane] = s.end
+			events = append(events, traceEvent{
+				Name:  st.Name,
+				Phase: "X",
+				Time:  s.start.Sub(start).Microseconds(),
+				Dur:   s.end.Sub(s.start).Microseconds(),
+				Pid:   1,
+				Tid:   tid + lane,
+				Args:  map[string]string{"item": fmt.Sprint(i)},
+			})
+		}
+		tid += len(lanes)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(struct {
+		TraceEvents []traceEvent `json:"traceEvents"`
+	}{events})
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestObserver(t *testing.T) {
+	checkLeaks(t)
+
+	o := &Observer{}
+	ExecutePipelineObserved(o,
+		job(func(in, out chan interface{}) {
+			for i := 0; i < 5; i++ {
+				out <- i
+			}
+		}),
+		// every item is slow, but all of them are processed at once,
+		// and reported
+		job(func(in, out chan interface{}) {
+			wg := &sync.WaitGroup{}
+			for val := range in {
+				wg.Add(1)
+				go func(val interface{}) {
+					defer wg.Done()
+					end := ObserveItem(out)
+					time.Sleep(50 * time.Millisecond)
+					end()
+					out <- val
+				}(val)
+			}
+			wg.Wait()
+		}),
+		job(func(in, out chan interface{}) {
+			for range in {
+			}
+		}),
+	)
+
+	stats := o.Stats()
+	if len(stats) != 3 {
+		t.Fatalf("wrong number of jobs\nGot: %d\nExpected: %d", len(stats), 3)
+	}
+	counts := [][2]int{{0, 5}, {5, 5}, {5, 0}}
+	for i, st := range stats {
+		if st.In != counts[i][0] || st.Out != counts[i][1] {
+			t.Errorf("wrong counts of %s\nGot: in %d, out %d\nExpected: in %d, out %d",
+				st.Name, st.In, st.Out, counts[i][0], counts[i][1])
+		}
+	}
+	slow := stats[1].Latency
+	if slow.Count != 5 || slow.Min < 50*time.Millisecond || slow.Counts[2] != 5 {
+		t.Errorf("wrong latency: %+v", slow)
+	}
+	// the other jobs do not report their items
+	if stats[0].Latency.Count != 0 || stats[2].Latency.Count != 0 {
+		t.Errorf("unexpected latency: %+v, %+v", stats[0].Latency, stats[2].Latency)
+	}
+
+	out := &bytes.Buffer{}
+	if err := o.WriteReport(out); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !strings.Contains(out.String(), "in 5, out 5, max queue") ||
+		!strings.Contains(out.String(), "<=100ms 5") {
+		t.Errorf("wrong report:\n%s", out)
+	}
+
+	out.Reset()
+	if err := o.WriteTrace(out); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var trace struct {
+		TraceEvents []traceEvent `json:"traceEvents"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &trace); err != nil {
+		t.Fatalf("bad trace: %s", err)
+	}
+	lanes := map[int]bool{}
+	items := 0
+	for _, e := range trace.TraceEvents {
+		if e.Phase == "X" && e.Name == stats[1].Name {
+			lanes[e.Tid] = true
+			items++
+		}
+	}
+	// the items of the slow job overlap, so they cannot share a lane
+	if items != 5 || len(lanes) != 5 {
+		t.Errorf("wrong trace of %s: %d items in %d lanes\n%s", stats[1].Name, items, len(lanes), out)
+	}
+}
+
+// the items of SingleHash and MultiHash are the hashing of each value:
+// about a second of DataSignerCrc32, all of them at once
+func TestObserverSigners(t *testing.T) {
+	checkLeaks(t)
+
+	const items = 3
+	o := &Observer{}
+	ExecutePipelineObserved(o,
+		job(func(in, out chan interface{}) {
+			for i := 0; i < items; i++ {
+				out <- i
+			}
+		}),
+		job(SingleHash),
+		job(MultiHash),
+		job(CombineResults),
+	)
+
+	out := &bytes.Buffer{}
+	if err := o.WriteTrace(out); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var trace struct {
+		TraceEvents []traceEvent `json:"traceEvents"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &trace); err != nil {
+		t.Fatalf("bad trace: %s", err)
+	}
+	for _, name := range []string{"SingleHash", "MultiHash"} {
+		lanes := map[int]bool{}
+		spans := 0
+		for _, e := range trace.TraceEvents {
+			if e.Phase != "X" || e.Name != name {
+				continue
+			}
+			spans++
+			lanes[e.Tid] = true
+			if d := time.Duration(e.Dur) * time.Microsecond; d < time.Second || d > 1500*time.Millisecond {
+				t.Errorf("wrong span of %s\nGot: %s\nExpected: about %s", name, d, time.Second)
+			}
+		}
+		if spans != items || len(lanes) != items {
+			t.Errorf("wrong trace of %s: %d items in %d lanes\n%s", name, spans, len(lanes), out)
+		}
+	}
+}
+
+// the job stops reading its input, the observer must not hang
+func TestObserverEarlyReturn(t *testing.T) {
+	checkLeaks(t)
+
+	o := &Observer{}
+	ExecutePipelineObserved(o,
+		job(func(in, out chan interface{}) {
+			for i := 0; i < MaxInputDataLen*3; i++ {
+				out <- i
+			}
+		}),
+		job(func(in, out chan interface{}) {
+			out <- <-in
+		}),
+	)
+	if st := o.Stats()[1]; st.Out != 1 {
+		t.Errorf("wrong output count\nGot: %d\nExpected: %d", st.Out, 1)
+	}
+}
+
+func TestJobName(t *testing.T) {
+	for _, j := range []struct {
+		job  job
+		name string
+	}{
+		{SingleHash, "SingleHash"},
+		{MultiHash, "MultiHash"},
+		{CombineResults, "CombineResults"},
+	} {
+		if name := jobName(j.job, 0); name != j.name {
+			t.Errorf("wrong name\nGot: %s\nExpected: %s", name, j.name)
+		}
+	}
+}
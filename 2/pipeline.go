@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+)
+
+// contextJob is a pipeline stage that can fail. It must return once ctx
+// is done, so sends to out should go through send.
+type contextJob func(ctx context.Context, in <-chan interface{}, out chan<- interface{}) error
+
+// ExecutePipelineContext works like ExecutePipeline, but the first job
+// error cancels the context of all the stages and is returned. Every
+// stage drains its input after the job returns, so a stage upstream
+// of a failed one never stays blocked on a send.
+func ExecutePipelineContext(parent context.Context, jobs ...contextJob) error {
+	stages := make([]StageConfig, len(jobs))
+	for i, j := range jobs {
+		stages[i] = StageConfig{Job: j}
+	}
+	return ExecutePipelineConfig(parent, stages...)
+}
+
+// send writes v to out unless ctx is done first.
+func send(ctx context.Context, out chan<- interface{}, v interface{}) error {
+	select {
+	case out <- v:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func drain[T any](in <-chan T) {
+	for range in {
+	}
+}
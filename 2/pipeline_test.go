@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// checkLeaks fails the test if goroutines started by it are still
+// running shortly after it is done
+func checkLeaks(t *testing.T) {
+	t.Helper()
+	before := runtime.NumGoroutine()
+	t.Cleanup(func() {
+		deadline := time.Now().Add(time.Second)
+		for runtime.NumGoroutine() > before {
+			if time.Now().After(deadline) {
+				buf := make([]byte, 1<<16)
+				n := runtime.Stack(buf, true)
+				t.Errorf("goroutines leaked: %d, were %d\n%s", runtime.NumGoroutine(), before, buf[:n])
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+}
+
+// generate sends 0, 1, 2... until limit, forever if limit is 0
+func generate(limit int) contextJob {
+	return func(ctx context.Context, in <-chan interface{}, out chan<- interface{}) error {
+		for i := 0; limit == 0 || i < limit; i++ {
+			if err := send(ctx, out, i); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func TestPipelineContextOK(t *testing.T) {
+	checkLeaks(t)
+
+	var sum int64
+	err := ExecutePipelineContext(context.Background(),
+		generate(10),
+		func(ctx context.Context, in <-chan interface{}, out chan<- interface{}) error {
+			for val := range in {
+				if err := send(ctx, out, val.(int)*val.(int)); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		func(ctx context.Context, in <-chan interface{}, out chan<- interface{}) error {
+			for val := range in {
+				atomic.AddInt64(&sum, int64(val.(int)))
+			}
+			return nil
+		},
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if sum != 285 {
+		t.Errorf("wrong sum\nGot: %d\nExpected: %d", sum, 285)
+	}
+}
+
+var errBadInput = errors.New("bad input")
+
+func TestPipelineContextError(t *testing.T) {
+	checkLeaks(t)
+
+	var collected int64
+	err := ExecutePipelineContext(context.Background(),
+		// endless input, stops only by cancellation
+		generate(0),
+		func(ctx context.Context, in <-chan interface{}, out chan<- interface{}) error {
+			for val := range in {
+				if val.(int) == 5 {
+					return errBadInput
+				}
+				if err := send(ctx, out, val); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		func(ctx context.Context, in <-chan interface{}, out chan<- interface{}) error {
+			for range in {
+				atomic.AddInt64(&collected, 1)
+			}
+			return nil
+		},
+	)
+	if !errors.Is(err, errBadInput) {
+		t.Fatalf("wrong error\nGot: %v\nExpected: %v", err, errBadInput)
+	}
+	if collected != 5 {
+		t.Errorf("wrong number of collected values\nGot: %d\nExpected: %d", collected, 5)
+	}
+}
+
+// the first stage ignores the context and the failed stage does not read
+// its input anymore, the pipeline has to drain it to finish
+func TestPipelineContextDrain(t *testing.T) {
+	checkLeaks(t)
+
+	err := ExecutePipelineContext(context.Background(),
+		func(ctx context.Context, in <-chan interface{}, out chan<- interface{}) error {
+			for i := 0; i < MaxInputDataLen*5; i++ {
+				out <- i
+			}
+			return nil
+		},
+		func(ctx context.Context, in <-chan interface{}, out chan<- interface{}) error {
+			<-in
+			return errBadInput
+		},
+	)
+	if !errors.Is(err, errBadInput) {
+		t.Fatalf("wrong error\nGot: %v\nExpected: %v", err, errBadInput)
+	}
+}
+
+func TestPipelineContextCancel(t *testing.T) {
+	checkLeaks(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := ExecutePipelineContext(ctx,
+		generate(0),
+		func(ctx context.Context, in <-chan interface{}, out chan<- interface{}) error {
+			for val := range in {
+				time.Sleep(time.Millisecond)
+				if err := send(ctx, out, val); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("wrong error\nGot: %v\nExpected: %v", err, context.DeadlineExceeded)
+	}
+	if end := time.Since(start); end > time.Second {
+		t.Errorf("pipeline did not stop on cancel, took %s", end)
+	}
+}
+
+// the output of the last stage is not read by anyone
+func TestPipelineContextUnreadOutput(t *testing.T) {
+	checkLeaks(t)
+
+	err := ExecutePipelineContext(context.Background(), generate(MaxInputDataLen*3))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Resource guards a shared dependency, like a signer, that can only take
+// limit callers at once and perSecond calls a second. Stages wrap their
+// calls with Guard instead of serializing by hand.
+type Resource struct {
+	name     string
+	slots    chan struct{}
+	interval time.Duration
+
+	mu    sync.Mutex
+	next  time.Time
+	stats ResourceStats
+}
+
+// ResourceStats shows how much callers waited for a resource.
+type ResourceStats struct {
+	Name      string
+	Calls     int
+	InUse     int
+	TotalWait time.Duration
+	MaxWait   time.Duration
+}
+
+// AvgWait is the mean time a call waited to acquire the resource.
+func (s ResourceStats) AvgWait() time.Duration {
+	if s.Calls == 0 {
+		return 0
+	}
+	return s.TotalWait / time.Duration(s.Calls)
+}
+
+// NewResource creates a guard. limit <= 0 means no concurrency limit
+// and perSecond <= 0 no rate limit.
+func NewResource(name string, limit int, perSecond float64) *Resource {
+	r := &Resource{name: name}
+	if limit > 0 {
+		r.slots = make(chan struct{}, limit)
+	}
+	if perSecond > 0 {
+		r.interval = time.Duration(float64(time.Second) / perSecond)
+	}
+	r.stats.Name = name
+	return r
+}
+
+// Acquire blocks until the resource may be used and returns the function
+// that gives it back. It fails only when ctx is done first.
+func (r *Resource) Acquire(ctx context.Context) (func(), error) {
+	start := time.Now()
+	if r.slots != nil {
+		select {
+		case r.slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	if wait := r.reserve(); wait > 0 {
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			r.free()
+			return nil, ctx.Err()
+		}
+	}
+	r.record(time.Since(start))
+
+	once := &sync.Once{}
+	return func() {
+		once.Do(r.release)
+	}, nil
+}
+
+// Do runs f holding the resource.
+func (r *Resource) Do(f func()) {
+	release, _ := r.Acquire(context.Background())
+	defer release()
+	f()
+}
+
+// reserve takes the next free slot of the rate limit and returns how
+// long to wait for it.
+func (r *Resource) reserve() time.Duration {
+	if r.interval == 0 {
+		return 0
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	at := r.next
+	if at.Before(now) {
+		at = now
+	}
+	r.next = at.Add(r.interval)
+	return at.Sub(now)
+}
+
+func (r *Resource) record(wait time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stats.Calls++
+	r.stats.InUse++
+	r.stats.TotalWait += wait
+	if wait > r.stats.MaxWait {
+		r.stats.MaxWait = wait
+	}
+}
+
+func (r *Resource) release() {
+	r.mu.Lock()
+	r.stats.InUse--
+	r.mu.Unlock()
+	r.free()
+}
+
+func (r *Resource) free() {
+	if r.slots != nil {
+		<-r.slots
+	}
+}
+
+// Stats returns a snapshot of the wait metrics.
+func (r *Resource) Stats() ResourceStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.stats
+}
+
+// Guard wraps f so every call holds all the resources, taken in the
+// order given. Use the same order everywhere to avoid deadlocks.
+func Guard[In, Out any](f func(In) Out, resources ...*Resource) func(In) Out {
+	return func(v In) Out {
+		for _, r := range resources {
+			release, _ := r.Acquire(context.Background())
+			defer release()
+		}
+		return f(v)
+	}
+}
+
+// Resources is a registry of the guarded resources of a pipeline,
+// so their metrics can be reported together.
+type Resources struct {
+	mu        sync.Mutex
+	resources []*Resource
+}
+
+// Declare adds a resource to the registry, or returns the one already
+// declared with this name.
+func (rs *Resources) Declare(name string, limit int, perSecond float64) *Resource {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	for _, r := range rs.resources {
+		if r.name == name {
+			return r
+		}
+	}
+	r := NewResource(name, limit, perSecond)
+	rs.resources = append(rs.resources, r)
+	return r
+}
+
+// Stats returns the metrics of every resource in declaration order.
+func (rs *Resources) Stats() []ResourceStats {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	stats := make([]ResourceStats, 0, len(rs.resources))
+	for _, r := range rs.resources {
+		stats = append(stats, r.Stats())
+	}
+	return stats
+}
+
+// WriteReport prints one line of wait metrics per resource.
+func (rs *Resources) WriteReport(w io.Writer) error {
+	for _, s := range rs.Stats() {
+		_, err := fmt.Fprintf(w, "%s: calls %d, in use %d, wait total %s, avg %s, max %s\n",
+			s.Name, s.Calls, s.InUse, s.TotalWait, s.AvgWait(), s.MaxWait)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SignerResources guards the data signers. DataSignerMd5 overheats when
+// called concurrently, so it takes one caller at a time.
+var SignerResources = &Resources{}
+
+var (
+	md5Resource   = SignerResources.Declare("md5", 1, 0)
+	crc32Resource = SignerResources.Declare("crc32", 0, 0)
+)
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// concurrency tracks how many callers are inside at once
+type concurrency struct {
+	cur, max int64
+}
+
+func (c *concurrency) enter() {
+	n := atomic.AddInt64(&c.cur, 1)
+	for {
+		max := atomic.LoadInt64(&c.max)
+		if n <= max || atomic.CompareAndSwapInt64(&c.max, max, n) {
+			return
+		}
+	}
+}
+
+func (c *concurrency) leave() {
+	atomic.AddInt64(&c.cur, -1)
+}
+
+func TestResourceLimit(t *testing.T) {
+	r := NewResource("disk", 2, 0)
+	c := &concurrency{}
+	work := Guard(func(n int) int {
+		c.enter()
+		defer c.leave()
+		time.Sleep(20 * time.Millisecond)
+		return n
+	}, r)
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			work(i)
+		}(i)
+	}
+	wg.Wait()
+
+	if c.max != 2 {
+		t.Errorf("wrong concurrency\nGot: %d\nExpected: %d", c.max, 2)
+	}
+	stats := r.Stats()
+	if stats.Calls != 10 || stats.InUse != 0 {
+		t.Errorf("wrong stats: %+v", stats)
+	}
+	// 10 calls of 20ms two at a time, the last ones wait for 80ms
+	if stats.MaxWait < 60*time.Millisecond || stats.TotalWait <= stats.MaxWait {
+		t.Errorf("wait time not recorded: %+v", stats)
+	}
+}
+
+func TestResourceRate(t *testing.T) {
+	r := NewResource("api", 0, 50)
+
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		r.Do(func() {})
+	}
+	// the first call goes right away, the other four are 20ms apart
+	if end := time.Since(start); end < 80*time.Millisecond {
+		t.Errorf("rate not limited\nGot: %s\nExpected: >=%s", end, 80*time.Millisecond)
+	}
+}
+
+func TestResourceAcquireCancel(t *testing.T) {
+	r := NewResource("md5", 1, 0)
+	release, err := r.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := r.Acquire(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("wrong error\nGot: %v\nExpected: %v", err, context.DeadlineExceeded)
+	}
+
+	// releasing twice gives back a single slot
+	release()
+	release()
+	release, err = r.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	release()
+	if stats := r.Stats(); stats.Calls != 2 || stats.InUse != 0 {
+		t.Errorf("wrong stats: %+v", stats)
+	}
+}
+
+func TestResourcesReport(t *testing.T) {
+	rs := &Resources{}
+	first := rs.Declare("md5", 1, 0)
+	if again := rs.Declare("md5", 5, 0); again != first {
+		t.Errorf("resource declared twice")
+	}
+	rs.Declare("crc32", 0, 0).Do(func() {})
+
+	out := &bytes.Buffer{}
+	if err := rs.WriteReport(out); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 ||
+		!strings.HasPrefix(lines[0], "md5: calls 0, in use 0,") ||
+		!strings.HasPrefix(lines[1], "crc32: calls 1, in use 0,") {
+		t.Errorf("wrong report:\n%s", out)
+	}
+}
+
+// md5 of every value is requested at once, the guard has to keep
+// DataSignerMd5 from overheating
+func TestSignerPipelineNoOverheat(t *testing.T) {
+	c := &concurrency{}
+	signer := DataSignerMd5
+	defer func() { DataSignerMd5 = signer }()
+	DataSignerMd5 = func(data string) string {
+		c.enter()
+		defer c.leave()
+		return signer(data)
+	}
+
+	before := md5Resource.Stats().Calls
+	collect(Start(SignerPipeline(), FromSlice([]int{0, 1, 1, 2, 3, 5, 8})))
+
+	if c.max != 1 {
+		t.Errorf("DataSignerMd5 called concurrently: %d", c.max)
+	}
+	if calls := md5Resource.Stats().Calls - before; calls != 7 {
+		t.Errorf("wrong md5 calls\nGot: %d\nExpected: %d", calls, 7)
+	}
+}
@@ -1,3 +1,159 @@
-package main
-
-// сюда писать код
\ No newline at end of file
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ExecutePipeline runs every job in its own goroutine, the out channel of
+// one job being the in channel of the next, and waits for all of them.
+// A channel is closed as soon as the job writing to it returns.
+func ExecutePipeline(jobs ...job) {
+	if len(jobs) == 0 {
+		return
+	}
+	pipeline := Stage[interface{}, interface{}](jobs[0])
+	for _, j := range jobs[1:] {
+		pipeline = Pipe(pipeline, Stage[interface{}, interface{}](j))
+	}
+	Run(pipeline, FromSlice[interface{}](nil))
+}
+
+// SingleHash sends crc32(data)+"~"+crc32(md5(data)) for every input.
+// Every item is hashed in its own goroutine; the md5 resource lets
+// only one of them into DataSignerMd5 at a time.
+func SingleHash(in, out chan interface{}) {
+	DefaultHasher.SingleHash(in, out)
+}
+
+// MultiHash sends the concatenation of crc32(th+data) for th=0..5.
+func MultiHash(in, out chan interface{}) {
+	DefaultHasher.MultiHash(in, out)
+}
+
+// Hasher is SingleHash and MultiHash over any pair of signers:
+// Digest takes the place of md5 and Checksum the place of crc32.
+type Hasher struct {
+	Digest   Signer
+	Checksum Signer
+}
+
+// DefaultHasher is the md5 and crc32 pair of SingleHash and MultiHash.
+var DefaultHasher = Hasher{Digest: Md5Signer, Checksum: Crc32Signer}
+
+// NewHasher returns the Hasher of two registered signers.
+func NewHasher(digest, checksum string) (Hasher, error) {
+	d, err := LookupSigner(digest)
+	if err != nil {
+		return Hasher{}, err
+	}
+	c, err := LookupSigner(checksum)
+	if err != nil {
+		return Hasher{}, err
+	}
+	return Hasher{Digest: d, Checksum: c}, nil
+}
+
+// String names the signers of h, like "md5,crc32".
+func (h Hasher) String() string {
+	return h.Digest.Name() + "," + h.Checksum.Name()
+}
+
+// SingleHash sends Checksum(data)+"~"+Checksum(Digest(data)) for every input.
+func (h Hasher) SingleHash(in, out chan interface{}) {
+	hashEach(in, out, h.single)
+}
+
+// MultiHash sends the concatenation of Checksum(th+data) for th=0..5.
+func (h Hasher) MultiHash(in, out chan interface{}) {
+	hashEach(in, out, h.multi)
+}
+
+func (h Hasher) single(data string) string {
+	return h.singleOf(data, h.Digest.Sign(data))
+}
+
+// singleOf is single with the digest of data already computed.
+func (h Hasher) singleOf(data, digest string) string {
+	checksum := make(chan string)
+	go func() {
+		checksum <- h.Checksum.Sign(data)
+	}()
+	checksumDigest := h.Checksum.Sign(digest)
+	return <-checksum + "~" + checksumDigest
+}
+
+const multiHashSteps = 6
+
+func (h Hasher) multi(data string) string {
+	steps := make([]string, multiHashSteps)
+	for th := range steps {
+		steps[th] = strconv.Itoa(th) + data
+	}
+	// all the steps at once, joined in order
+	join := Collect(func(results []string) string {
+		return strings.Join(results, "")
+	})
+	return <-Start(Pipe(OrderedParallelMap(multiHashSteps, h.Checksum.Sign), join), FromSlice(steps))
+}
+
+// hashEach sends hash of every input, each computed in its own goroutine.
+// The hashing of every item is reported to ObserveItem.
+func hashEach(in, out chan interface{}, hash func(string) string) {
+	wg := &sync.WaitGroup{}
+	for dataRaw := range in {
+		wg.Add(1)
+		go func(data string) {
+			defer wg.Done()
+			end := ObserveItem(out)
+			result := hash(data)
+			end()
+			out <- result
+		}(fmt.Sprint(dataRaw))
+	}
+	wg.Wait()
+}
+
+// CombineResults sorts all the results and joins them with "_".
+func CombineResults(in, out chan interface{}) {
+	var results []string
+	for dataRaw := range in {
+		results = append(results, fmt.Sprint(dataRaw))
+	}
+	out <- combineResults(results)
+}
+
+func combineResults(results []string) string {
+	sort.Strings(results)
+	return strings.Join(results, "_")
+}
+
+// signedData is an input of the signer with its digest already computed.
+type signedData struct {
+	data   string
+	digest string
+}
+
+// SignerPipeline is the SingleHash -> MultiHash -> CombineResults chain
+// with typed stages. All the stages are parallel, the signer resources
+// keep DataSignerMd5 from overheating.
+func SignerPipeline() Stage[int, string] {
+	return DefaultHasher.Pipeline()
+}
+
+// Pipeline is SignerPipeline over the signers of h.
+func (h Hasher) Pipeline() Stage[int, string] {
+	digest := ParallelMap(func(n int) signedData {
+		data := strconv.Itoa(n)
+		return signedData{data: data, digest: h.Digest.Sign(data)}
+	})
+	single := ParallelMap(func(d signedData) string {
+		return h.singleOf(d.data, d.digest)
+	})
+	multi := ParallelMap(h.multi)
+	combine := Collect(combineResults)
+	return Pipe(Pipe(Pipe(digest, single), multi), combine)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// Signer computes the hash of data. Signers add DataSignerSalt to data
+// the way DataSignerMd5 and DataSignerCrc32 do.
+type Signer interface {
+	Name() string
+	Sign(data string) string
+}
+
+type funcSigner struct {
+	name string
+	sign func(string) string
+}
+
+func (s funcSigner) Name() string {
+	return s.name
+}
+
+func (s funcSigner) Sign(data string) string {
+	return s.sign(data)
+}
+
+// NewSigner makes a Signer of a function.
+func NewSigner(name string, sign func(data string) string) Signer {
+	return funcSigner{name: name, sign: sign}
+}
+
+// Md5Signer and Crc32Signer call the current signer variables,
+// which tests replace, through their resources.
+var (
+	Md5Signer = NewSigner("md5", Guard(func(data string) string {
+		return DataSignerMd5(data)
+	}, md5Resource))
+	Crc32Signer = NewSigner("crc32", Guard(func(data string) string {
+		return DataSignerCrc32(data)
+	}, crc32Resource))
+)
+
+// Sha256Signer is the hex sha256 of data.
+var Sha256Signer = NewSigner("sha256", func(data string) string {
+	sum := sha256.Sum256([]byte(data + DataSignerSalt))
+	return hex.EncodeToString(sum[:])
+})
+
+// XXHashSigner is the 64-bit xxHash of data with seed 0, in decimal
+// like crc32.
+var XXHashSigner = NewSigner("xxhash", func(data string) string {
+	return strconv.FormatUint(xxhash64([]byte(data+DataSignerSalt), 0), 10)
+})
+
+var (
+	signersMu sync.Mutex
+	signers   = map[string]Signer{}
+)
+
+func init() {
+	for _, s := range []Signer{Md5Signer, Crc32Signer, Sha256Signer, XXHashSigner} {
+		RegisterSigner(s)
+	}
+}
+
+// RegisterSigner makes s available by its name to LookupSigner and
+// NewHasher. It panics if the name is taken.
+func RegisterSigner(s Signer) {
+	signersMu.Lock()
+	defer signersMu.Unlock()
+	if _, ok := signers[s.Name()]; ok {
+		panic("signer registered twice: " + s.Name())
+	}
+	signers[s.Name()] = s
+}
+
+// LookupSigner returns the signer registered as name.
+func LookupSigner(name string) (Signer, error) {
+	signersMu.Lock()
+	defer signersMu.Unlock()
+	s, ok := signers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown signer %q", name)
+	}
+	return s, nil
+}
+
+// SignerNames returns the names of the registered signers, sorted.
+func SignerNames() []string {
+	signersMu.Lock()
+	defer signersMu.Unlock()
+	names := make([]string, 0, len(signers))
+	for name := range signers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
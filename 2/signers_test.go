@@ -0,0 +1,121 @@
+package main
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestXXHash64(t *testing.T) {
+	for _, c := range []struct {
+		data string
+		hash uint64
+	}{
+		{"", 0xef46db3751d8e999},
+		{"a", 0xd24ec4f1a98c6e5b},
+		{"abc", 0x44bc2cf5ad770999},
+		{"Nobody inspects the spammish repetition", 0xfbcea83c8a378bf1},
+	} {
+		if hash := xxhash64([]byte(c.data), 0); hash != c.hash {
+			t.Errorf("wrong hash of %q\nGot: %x\nExpected: %x", c.data, hash, c.hash)
+		}
+	}
+}
+
+func TestSignerRegistry(t *testing.T) {
+	expected := []string{"crc32", "md5", "sha256", "xxhash"}
+	if names := SignerNames(); !reflect.DeepEqual(names, expected) {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", names, expected)
+	}
+	if _, err := LookupSigner("md4"); err == nil {
+		t.Errorf("expected error for an unknown signer")
+	}
+	if _, err := NewHasher("md5", "md4"); err == nil {
+		t.Errorf("expected error for an unknown signer")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected panic for a signer registered twice")
+		}
+	}()
+	RegisterSigner(NewSigner("md5", strings.ToUpper))
+}
+
+func TestSha256Salt(t *testing.T) {
+	salt := DataSignerSalt
+	defer func() { DataSignerSalt = salt }()
+
+	DataSignerSalt = ""
+	unsalted := Sha256Signer.Sign("0")
+	expected := "5feceb66ffc86f38d952786c6d696c79c2dbc239dd4e91b46729d73a27fb57e9"
+	if unsalted != expected {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", unsalted, expected)
+	}
+	DataSignerSalt = "salt"
+	if Sha256Signer.Sign("0") == unsalted {
+		t.Errorf("salt not used")
+	}
+}
+
+// the signers of a Hasher are easy to fake
+func TestHasherFake(t *testing.T) {
+	var calls uint32
+	h := Hasher{
+		Digest: NewSigner("upper", strings.ToUpper),
+		Checksum: NewSigner("len", func(data string) string {
+			atomic.AddUint32(&calls, 1)
+			return strconv.Itoa(len(data))
+		}),
+	}
+	if h.String() != "upper,len" {
+		t.Errorf("wrong name\nGot: %s\nExpected: %s", h.String(), "upper,len")
+	}
+
+	var result string
+	ExecutePipeline(
+		job(func(in, out chan interface{}) {
+			out <- "ab"
+			out <- "abc"
+		}),
+		h.SingleHash,
+		h.MultiHash,
+		CombineResults,
+		job(func(in, out chan interface{}) {
+			result = (<-in).(string)
+		}),
+	)
+	// "ab" -> "2~2" -> "4" six times, "abc" -> "3~3" -> "4" six times
+	expected := "444444_444444"
+	if result != expected {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", result, expected)
+	}
+	if calls != 2*8 {
+		t.Errorf("wrong calls\nGot: %d\nExpected: %d", calls, 2*8)
+	}
+}
+
+func TestHasherPipeline(t *testing.T) {
+	h, err := NewHasher("sha256", "xxhash")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	sign := func(data string) string {
+		xx := func(s string) string { return strconv.FormatUint(xxhash64([]byte(s), 0), 10) }
+		single := xx(data) + "~" + xx(Sha256Signer.Sign(data))
+		multi := ""
+		for th := 0; th < multiHashSteps; th++ {
+			multi += xx(strconv.Itoa(th) + single)
+		}
+		return multi
+	}
+	results := []string{sign("1"), sign("2"), sign("3")}
+	expected := combineResults(results)
+
+	result := collect(Start(h.Pipeline(), FromSlice([]int{3, 1, 2})))
+	if len(result) != 1 || result[0] != expected {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", result, expected)
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"sync"
+)
+
+// Stage is a typed pipeline job: it reads values of In until in is
+// closed and writes values of Out. job is a Stage[interface{}, interface{}].
+type Stage[In, Out any] func(in chan In, out chan Out)
+
+// Start runs s over in in its own goroutine. The returned channel is
+// closed once s returns.
+func Start[In, Out any](s Stage[In, Out], in chan In) chan Out {
+	out := make(chan Out, MaxInputDataLen)
+	go func() {
+		defer close(out)
+		s(in, out)
+	}()
+	return out
+}
+
+// Run runs s over in and returns when it is done.
+// Whatever s writes is discarded.
+func Run[In, Out any](s Stage[In, Out], in chan In) {
+	out := make(chan Out, MaxInputDataLen)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		drain(out)
+	}()
+	s(in, out)
+	close(out)
+	<-done
+}
+
+// Pipe connects two stages into one: the output of first is the input
+// of second. If second returns early the rest of its input is drained,
+// so first always gets to finish.
+func Pipe[A, B, C any](first Stage[A, B], second Stage[B, C]) Stage[A, C] {
+	return func(in chan A, out chan C) {
+		mid := Start(first, in)
+		second(mid, out)
+		drain(mid)
+	}
+}
+
+// FromSlice returns a closed channel holding values.
+func FromSlice[T any](values []T) chan T {
+	ch := make(chan T, len(values))
+	for _, v := range values {
+		ch <- v
+	}
+	close(ch)
+	return ch
+}
+
+// Map applies f to every value, one at a time and in order.
+func Map[In, Out any](f func(In) Out) Stage[In, Out] {
+	return func(in chan In, out chan Out) {
+		for v := range in {
+			out <- f(v)
+		}
+	}
+}
+
+// ParallelMap applies f to every value in its own goroutine.
+// Results are sent as soon as they are ready, so their order is not kept.
+func ParallelMap[In, Out any](f func(In) Out) Stage[In, Out] {
+	return func(in chan In, out chan Out) {
+		wg := &sync.WaitGroup{}
+		for v := range in {
+			wg.Add(1)
+			go func(v In) {
+				defer wg.Done()
+				out <- f(v)
+			}(v)
+		}
+		wg.Wait()
+	}
+}
+
+// OrderedParallelMap applies f to every value in its own goroutine like
+// ParallelMap, but sends the results in the order of the input. A result
+// that is ready early waits in a reorder buffer for the ones before it.
+// At most window values, MaxInputDataLen if <= 0, are being mapped or
+// waiting at once: a slow value stops the reading of in rather than
+// letting the buffer grow.
+func OrderedParallelMap[In, Out any](window int, f func(In) Out) Stage[In, Out] {
+	if window <= 0 {
+		window = MaxInputDataLen
+	}
+	type result struct {
+		seq int
+		v   Out
+	}
+	return func(in chan In, out chan Out) {
+		// a slot is taken for every value read and given back once its
+		// result is sent
+		slots := make(chan struct{}, window)
+		results := make(chan result, window)
+		go func() {
+			defer close(results)
+			wg := &sync.WaitGroup{}
+			for seq := 0; ; seq++ {
+				slots <- struct{}{}
+				v, ok := <-in
+				if !ok {
+					break
+				}
+				wg.Add(1)
+				go func(seq int, v In) {
+					defer wg.Done()
+					results <- result{seq: seq, v: f(v)}
+				}(seq, v)
+			}
+			wg.Wait()
+		}()
+
+		pending := make(map[int]Out, window)
+		next := 0
+		for r := range results {
+			pending[r.seq] = r.v
+			for v, ok := pending[next]; ok; v, ok = pending[next] {
+				delete(pending, next)
+				out <- v
+				next++
+				<-slots
+			}
+		}
+	}
+}
+
+// FanOut runs workers copies of s reading the same input and writing
+// to the same output.
+func FanOut[In, Out any](workers int, s Stage[In, Out]) Stage[In, Out] {
+	return func(in chan In, out chan Out) {
+		wg := &sync.WaitGroup{}
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				s(in, out)
+			}()
+		}
+		wg.Wait()
+	}
+}
+
+// Merge fans in: it forwards the values of all the channels to the
+// returned one, which is closed when all of them are.
+func Merge[T any](chans ...chan T) chan T {
+	out := make(chan T, MaxInputDataLen)
+	wg := &sync.WaitGroup{}
+	for _, ch := range chans {
+		wg.Add(1)
+		go func(ch chan T) {
+			defer wg.Done()
+			for v := range ch {
+				out <- v
+			}
+		}(ch)
+	}
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+	return out
+}
+
+// MergeOrdered merges channels whose values are each sorted by less
+// into a single sorted channel.
+func MergeOrdered[T any](less func(a, b T) bool, chans ...chan T) chan T {
+	out := make(chan T, MaxInputDataLen)
+	go func() {
+		defer close(out)
+		heads := make([]T, len(chans))
+		open := make([]bool, len(chans))
+		for i, ch := range chans {
+			heads[i], open[i] = <-ch
+		}
+		for {
+			next := -1
+			for i := range chans {
+				if open[i] && (next == -1 || less(heads[i], heads[next])) {
+					next = i
+				}
+			}
+			if next == -1 {
+				return
+			}
+			out <- heads[next]
+			heads[next], open[next] = <-chans[next]
+		}
+	}()
+	return out
+}
+
+// Collect waits for all the input and sends f of it as the only value.
+func Collect[In, Out any](f func([]In) Out) Stage[In, Out] {
+	return func(in chan In, out chan Out) {
+		var all []In
+		for v := range in {
+			all = append(all, v)
+		}
+		out <- f(all)
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func collect[T any](ch chan T) []T {
+	var all []T
+	for v := range ch {
+		all = append(all, v)
+	}
+	return all
+}
+
+func TestStagePipe(t *testing.T) {
+	checkLeaks(t)
+
+	double := Map(func(n int) int { return n * 2 })
+	format := Map(strconv.Itoa)
+	result := collect(Start(Pipe(double, format), FromSlice([]int{1, 2, 3})))
+
+	expected := []string{"2", "4", "6"}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", result, expected)
+	}
+}
+
+// the second stage takes one value only, the rest is drained for the first one
+func TestStagePipeEarlyReturn(t *testing.T) {
+	checkLeaks(t)
+
+	first := Stage[int, int](func(in chan int, out chan int) {
+		for i := 0; i < MaxInputDataLen*3; i++ {
+			out <- i
+		}
+	})
+	second := Stage[int, int](func(in chan int, out chan int) {
+		out <- <-in
+	})
+	result := collect(Start(Pipe(first, second), FromSlice[int](nil)))
+	if !reflect.DeepEqual(result, []int{0}) {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", result, []int{0})
+	}
+}
+
+func TestStageParallelMap(t *testing.T) {
+	checkLeaks(t)
+
+	slow := ParallelMap(func(n int) int {
+		time.Sleep(100 * time.Millisecond)
+		return n * n
+	})
+	start := time.Now()
+	result := collect(Start(slow, FromSlice([]int{1, 2, 3, 4, 5})))
+	if end := time.Since(start); end > 300*time.Millisecond {
+		t.Errorf("execution too long\nGot: %s\nExpected: <%s", end, 300*time.Millisecond)
+	}
+	sort.Ints(result)
+	expected := []int{1, 4, 9, 16, 25}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", result, expected)
+	}
+}
+
+// the first values are the slowest, they still have to come out first
+func TestStageOrderedParallelMap(t *testing.T) {
+	checkLeaks(t)
+
+	slow := OrderedParallelMap(10, func(n int) int {
+		time.Sleep(time.Duration(10-n) * 20 * time.Millisecond)
+		return n * n
+	})
+	start := time.Now()
+	result := collect(Start(slow, FromSlice([]int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9})))
+	if end := time.Since(start); end > 300*time.Millisecond {
+		t.Errorf("execution too long\nGot: %s\nExpected: <%s", end, 300*time.Millisecond)
+	}
+	expected := []int{0, 1, 4, 9, 16, 25, 36, 49, 64, 81}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", result, expected)
+	}
+}
+
+// a slow first value holds the reading of the input once the window is full
+func TestStageOrderedParallelMapWindow(t *testing.T) {
+	checkLeaks(t)
+
+	var started, startedWhileSlow int32
+	window := OrderedParallelMap(3, func(n int) int {
+		atomic.AddInt32(&started, 1)
+		if n == 0 {
+			time.Sleep(50 * time.Millisecond)
+			atomic.StoreInt32(&startedWhileSlow, atomic.LoadInt32(&started))
+		}
+		return n
+	})
+	result := collect(Start(window, FromSlice([]int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9})))
+	if n := atomic.LoadInt32(&startedWhileSlow); n != 3 {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", n, 3)
+	}
+	expected := []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", result, expected)
+	}
+}
+
+// a result is sent as soon as all the ones before it are, not at the end
+func TestStageOrderedParallelMapStreams(t *testing.T) {
+	checkLeaks(t)
+
+	in := make(chan int)
+	out := Start(OrderedParallelMap(0, func(n int) int { return n }), in)
+	for i := 0; i < 3; i++ {
+		in <- i
+		select {
+		case v := <-out:
+			if v != i {
+				t.Errorf("results not match\nGot: %v\nExpected: %v", v, i)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("value %d not sent before the input is closed", i)
+		}
+	}
+	close(in)
+	if v, ok := <-out; ok {
+		t.Errorf("unexpected value %v", v)
+	}
+}
+
+func TestStageFanOut(t *testing.T) {
+	checkLeaks(t)
+
+	square := FanOut(3, Map(func(n int) int {
+		time.Sleep(50 * time.Millisecond)
+		return n * n
+	}))
+	start := time.Now()
+	result := collect(Start(square, FromSlice([]int{1, 2, 3, 4, 5, 6})))
+	if end := time.Since(start); end > 250*time.Millisecond {
+		t.Errorf("execution too long\nGot: %s\nExpected: <%s", end, 250*time.Millisecond)
+	}
+	sort.Ints(result)
+	expected := []int{1, 4, 9, 16, 25, 36}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", result, expected)
+	}
+}
+
+func TestStageMerge(t *testing.T) {
+	checkLeaks(t)
+
+	result := collect(Merge(FromSlice([]int{1, 2}), FromSlice([]int{3}), FromSlice[int](nil)))
+	sort.Ints(result)
+	if !reflect.DeepEqual(result, []int{1, 2, 3}) {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", result, []int{1, 2, 3})
+	}
+}
+
+func TestStageMergeOrdered(t *testing.T) {
+	checkLeaks(t)
+
+	less := func(a, b string) bool { return a < b }
+	result := collect(MergeOrdered(less,
+		FromSlice([]string{"a", "d", "e"}),
+		FromSlice([]string{"b", "c", "f", "g"}),
+		FromSlice[string](nil),
+		FromSlice([]string{"a", "h"}),
+	))
+	expected := []string{"a", "a", "b", "c", "d", "e", "f", "g", "h"}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", result, expected)
+	}
+}
+
+func TestSignerPipeline(t *testing.T) {
+	testExpected := "1173136728138862632818075107442090076184424490584241521304_1696913515191343735512658979631549563179965036907783101867_27225454331033649287118297354036464389062965355426795162684_29568666068035183841425683795340791879727309630931025356555_3994492081516972096677631278379039212655368881548151736_4958044192186797981418233587017209679042592862002427381542_4958044192186797981418233587017209679042592862002427381542"
+
+	start := time.Now()
+	result := collect(Start(SignerPipeline(), FromSlice([]int{0, 1, 1, 2, 3, 5, 8})))
+	end := time.Since(start)
+
+	if len(result) != 1 || result[0] != testExpected {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", result, testExpected)
+	}
+	if expectedTime := 3 * time.Second; end > expectedTime {
+		t.Errorf("execition too long\nGot: %s\nExpected: <%s", end, expectedTime)
+	}
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// benchmarks are the guarded benchmarks of bench_test.go, by the name
+// they have in the baseline.
+var benchmarks = []string{"FastSearch", "FastSearchParallel", "Report"}
+
+// benchFileEnv passes the file to search to the benchmarks.
+const benchFileEnv = "HW3_BENCH_FILE"
+
+// goTest runs go test with args in the package of hw3 and returns its
+// output. It is a variable so tests can fake it.
+var goTest = func(args []string, env []string) ([]byte, error) {
+	cmd := exec.Command("go", append([]string{"test"}, args...)...)
+	cmd.Env = append(os.Environ(), env...)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("go test: %w\n%s", err, out)
+	}
+	return out, nil
+}
+
+// benchResult is a line of go test -bench -benchmem output, which is
+// the format of the baseline file, so benchstat reads it as well.
+type benchResult struct {
+	name   string
+	n      int
+	ns     int64
+	bytes  int64
+	allocs int64
+}
+
+func (r benchResult) String() string {
+	return fmt.Sprintf("Benchmark%s\t%d\t%d ns/op\t%d B/op\t%d allocs/op", r.name, r.n, r.ns, r.bytes, r.allocs)
+}
+
+// bench runs the benchmarks over the file of opts with go test, from
+// the directory of the sources of hw3, and compares them with the
+// baseline, failing if one of them regressed beyond the threshold. A
+// missing baseline is written instead.
+func bench(out io.Writer, opts options) error {
+	path, err := filepath.Abs(opts.path)
+	if err != nil {
+		return err
+	}
+	opts.path = path
+	if opts.profile != "" {
+		if err := os.MkdirAll(opts.profile, 0o755); err != nil {
+			return err
+		}
+	}
+
+	results := make([]benchResult, 0, len(benchmarks))
+	for _, name := range benchmarks {
+		r, err := measure(name, opts)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		results = append(results, r)
+	}
+
+	baseline, err := readBaseline(opts.baseline)
+	if errors.Is(err, os.ErrNotExist) {
+		opts.update = true
+	} else if err != nil {
+		return err
+	}
+	if opts.update {
+		for _, r := range results {
+			fmt.Fprintln(out, r)
+		}
+		return writeBaseline(opts.baseline, results)
+	}
+
+	regressions := compareBenchmarks(out, baseline, results, opts.threshold)
+	if regressions > 0 {
+		return fmt.Errorf("%d results regressed beyond %g%%", regressions, opts.threshold*100)
+	}
+	return nil
+}
+
+// measure runs the benchmark name opts.count times and keeps the
+// fastest run. The profiles cover all the runs.
+func measure(name string, opts options) (benchResult, error) {
+	args := []string{
+		"-run", "^$",
+		"-bench", "^Benchmark" + name + "$",
+		"-benchmem",
+		"-count", strconv.Itoa(opts.count),
+		"-benchtime", opts.benchtime,
+	}
+	if opts.profile != "" {
+		// the test binary is kept next to the profiles, not in the sources
+		args = append(args,
+			"-o", filepath.Join(opts.profile, "hw3.test"),
+			"-cpuprofile", filepath.Join(opts.profile, name+".cpu.pprof"),
+			"-memprofile", filepath.Join(opts.profile, name+".heap.pprof"),
+		)
+	}
+	output, err := goTest(args, []string{benchFileEnv + "=" + opts.path})
+	if err != nil {
+		return benchResult{}, err
+	}
+
+	var best benchResult
+	found := false
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || !strings.HasPrefix(fields[0], "Benchmark") {
+			continue
+		}
+		r, err := parseBenchResult(fields)
+		if err != nil || r.name != name {
+			continue
+		}
+		if !found || r.ns < best.ns {
+			best, found = r, true
+		}
+	}
+	if !found {
+		return benchResult{}, fmt.Errorf("no result in go test output:\n%s", output)
+	}
+	return best, nil
+}
+
+// compareBenchmarks writes a table of the results against the baseline
+// and returns how many grew beyond threshold. Benchmarks missing from
+// the baseline are new and cannot regress.
+func compareBenchmarks(out io.Writer, baseline map[string]benchResult, results []benchResult, threshold float64) int {
+	tw := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "BENCHMARK\tMETRIC\tBASELINE\tCURRENT\tDELTA\t")
+	regressions := 0
+	for _, r := range results {
+		base, ok := baseline[r.name]
+		for _, m := range []struct {
+			metric    string
+			old, next int64
+		}{
+			{"ns/op", base.ns, r.ns},
+			{"B/op", base.bytes, r.bytes},
+			{"allocs/op", base.allocs, r.allocs},
+		} {
+			if !ok {
+				fmt.Fprintf(tw, "%s\t%s\t-\t%d\tnew\t\n", r.name, m.metric, m.next)
+				continue
+			}
+			delta, verdict := "~", ""
+			if m.old != 0 {
+				delta = fmt.Sprintf("%+.1f%%", float64(m.next-m.old)/float64(m.old)*100)
+			}
+			if float64(m.next) > float64(m.old)*(1+threshold) {
+				regressions++
+				verdict = "regression"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%s\t%s\n", r.name, m.metric, m.old, m.next, delta, verdict)
+		}
+	}
+	tw.Flush()
+	return regressions
+}
+
+// readBaseline reads the benchmark lines of path, ignoring the others.
+func readBaseline(path string) (map[string]benchResult, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	baseline := map[string]benchResult{}
+	scanner := bufio.NewScanner(file)
+	for i := 1; scanner.Scan(); i++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || !strings.HasPrefix(fields[0], "Benchmark") {
+			continue
+		}
+		r, err := parseBenchResult(fields)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, i, err)
+		}
+		baseline[r.name] = r
+	}
+	return baseline, scanner.Err()
+}
+
+func parseBenchResult(fields []string) (benchResult, error) {
+	if len(fields) < 2 || len(fields)%2 != 0 {
+		return benchResult{}, errors.New("malformed benchmark line")
+	}
+	// go test adds -GOMAXPROCS to the names
+	name := strings.TrimPrefix(fields[0], "Benchmark")
+	if i := strings.LastIndexByte(name, '-'); i >= 0 {
+		if _, err := strconv.Atoi(name[i+1:]); err == nil {
+			name = name[:i]
+		}
+	}
+	r := benchResult{name: name}
+	n, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return benchResult{}, err
+	}
+	r.n = n
+	for i := 2; i < len(fields); i += 2 {
+		v, err := strconv.ParseFloat(fields[i], 64)
+		if err != nil {
+			return benchResult{}, err
+		}
+		switch fields[i+1] {
+		case "ns/op":
+			r.ns = int64(v)
+		case "B/op":
+			r.bytes = int64(v)
+		case "allocs/op":
+			r.allocs = int64(v)
+		}
+	}
+	return r, nil
+}
+
+func writeBaseline(path string, results []benchResult) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(file)
+	for _, r := range results {
+		fmt.Fprintln(w, r)
+	}
+	if err := w.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
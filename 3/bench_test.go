@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadBaseline(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bench.txt")
+	results := []benchResult{{"FastSearch", 700, 1672313, 102608, 155}, {"Report", 10, 5, 0, 0}}
+	if err := writeBaseline(path, results); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	// go test output is a baseline as well
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	f.WriteString("goos: linux\nPASS\nBenchmarkSlow-8 \t 10 \t 142703250 ns/op \t 336887900 B/op \t 284175 allocs/op\n")
+	f.Close()
+
+	baseline, err := readBaseline(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := map[string]benchResult{
+		"FastSearch": results[0],
+		"Report":     results[1],
+		"Slow":       {"Slow", 10, 142703250, 336887900, 284175},
+	}
+	if len(baseline) != len(expected) {
+		t.Fatalf("results not match\nGot:\n%v\nExpected:\n%v", baseline, expected)
+	}
+	for name, r := range expected {
+		if baseline[name] != r {
+			t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", baseline[name], r)
+		}
+	}
+
+	ioutil.WriteFile(path, []byte("BenchmarkX 10 fast ns/op\n"), 0o644)
+	if _, err := readBaseline(path); err == nil || !strings.Contains(err.Error(), "bench.txt:1: ") {
+		t.Errorf("wrong error\nGot: %v\nExpected: %s:1: ...", err, path)
+	}
+}
+
+func TestCompareBenchmarks(t *testing.T) {
+	baseline := map[string]benchResult{
+		"A": {"A", 10, 1000, 100, 0},
+		"B": {"B", 10, 1000, 100, 10},
+	}
+	cases := []struct {
+		results     []benchResult
+		regressions int
+	}{
+		{[]benchResult{{"A", 10, 1100, 120, 0}, {"B", 10, 900, 50, 12}}, 0},
+		{[]benchResult{{"A", 10, 1300, 100, 0}}, 1},
+		{[]benchResult{{"A", 10, 1000, 100, 1}, {"B", 10, 1000, 121, 13}}, 3},
+		{[]benchResult{{"C", 10, 1e9, 1e9, 1e9}}, 0},
+	}
+	for _, c := range cases {
+		out := &bytes.Buffer{}
+		if n := compareBenchmarks(out, baseline, c.results, 0.2); n != c.regressions {
+			t.Errorf("results not match for %v\nGot:\n%v\nExpected:\n%v\n%s", c.results, n, c.regressions, out)
+		}
+		if strings.Count(out.String(), "regression") != c.regressions {
+			t.Errorf("regressions not marked:\n%s", out)
+		}
+	}
+}
+
+// fakeGoTest answers every benchmark run with count results, the
+// second the fastest, and records the arguments
+func fakeGoTest(t *testing.T, ns int64) *[][]string {
+	t.Helper()
+	var calls [][]string
+	old := goTest
+	goTest = func(args []string, env []string) ([]byte, error) {
+		calls = append(calls, append(args, env...))
+		name := strings.TrimSuffix(strings.TrimPrefix(args[3], "^Benchmark"), "$")
+		out := "goos: linux\n"
+		for _, r := range []benchResult{{name, 10, ns * 2, 100, 5}, {name, 20, ns, 100, 5}} {
+			r.name += "-8"
+			out += r.String() + "\n"
+		}
+		return []byte(out + "PASS\n"), nil
+	}
+	t.Cleanup(func() { goTest = old })
+	return &calls
+}
+
+func TestBench(t *testing.T) {
+	dir := t.TempDir()
+	opts := options{
+		path:      filePath,
+		baseline:  filepath.Join(dir, "bench.txt"),
+		threshold: 0.2,
+		count:     2,
+		benchtime: "1x",
+		profile:   filepath.Join(dir, "profiles"),
+	}
+	calls := fakeGoTest(t, 1000)
+
+	// the first run writes the baseline, keeping the fastest runs
+	out := &bytes.Buffer{}
+	if err := bench(out, opts); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	baseline, err := readBaseline(opts.baseline)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	abs, _ := filepath.Abs(filePath)
+	for i, name := range benchmarks {
+		if r := baseline[name]; r.n != 20 || r.ns != 1000 {
+			t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", r, benchResult{name, 20, 1000, 100, 5})
+		}
+		args := strings.Join((*calls)[i], " ")
+		for _, arg := range []string{
+			"-bench ^Benchmark" + name + "$", "-count 2", "-benchtime 1x",
+			"-cpuprofile " + filepath.Join(opts.profile, name+".cpu.pprof"),
+			benchFileEnv + "=" + abs,
+		} {
+			if !strings.Contains(args, arg) {
+				t.Errorf("no %s in go test %s", arg, args)
+			}
+		}
+	}
+
+	// the same results pass
+	out.Reset()
+	if err := bench(out, opts); err != nil {
+		t.Fatalf("unexpected error: %s\n%s", err, out)
+	}
+
+	// slower ones do not
+	fakeGoTest(t, 2000)
+	if err := bench(ioutil.Discard, opts); err == nil || !strings.Contains(err.Error(), "3 results regressed") {
+		t.Errorf("wrong error\nGot: %v\nExpected: 3 results regressed ...", err)
+	}
+
+	goTest = func(args []string, env []string) ([]byte, error) { return []byte("PASS\n"), nil }
+	if err := bench(ioutil.Discard, opts); err == nil || !strings.Contains(err.Error(), "no result") {
+		t.Errorf("wrong error\nGot: %v\nExpected: ... no result ...", err)
+	}
+}
+
+// hw3 bench runs the benchmarks of this file with go test
+func TestBenchGoTest(t *testing.T) {
+	if testing.Short() {
+		t.Skip("runs go test")
+	}
+	dir := t.TempDir()
+	opts := options{
+		path:      filePath,
+		baseline:  filepath.Join(dir, "bench.txt"),
+		threshold: 0.2,
+		count:     1,
+		benchtime: "1x",
+		profile:   filepath.Join(dir, "profiles"),
+	}
+	out := &bytes.Buffer{}
+	if err := bench(out, opts); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	baseline, err := readBaseline(opts.baseline)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for _, name := range benchmarks {
+		if baseline[name].n != 1 {
+			t.Errorf("no result for %s in\n%s", name, out)
+		}
+		for _, kind := range []string{"cpu", "heap"} {
+			if _, err := os.Stat(filepath.Join(opts.profile, name+"."+kind+".pprof")); err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+		}
+	}
+}
+
+// benchFile is the file of the benchmarks guarded by hw3 bench
+func benchFile() string {
+	if path := os.Getenv(benchFileEnv); path != "" {
+		return path
+	}
+	return filePath
+}
+
+// the benchmarks of hw3 bench, each pinned to its code path: the index
+// of the file is never used
+
+func BenchmarkFastSearch(b *testing.B) {
+	path := benchFile()
+	for i := 0; i < b.N; i++ {
+		in, err := OpenInput(path)
+		if err != nil {
+			b.Fatalf("unexpected error: %s", err)
+		}
+		err = androidMSIE.run(in, textOutput, ioutil.Discard)
+		in.Close()
+		if err != nil {
+			b.Fatalf("unexpected error: %s", err)
+		}
+	}
+}
+
+func BenchmarkFastSearchParallel(b *testing.B) {
+	path := benchFile()
+	for i := 0; i < b.N; i++ {
+		file, err := os.Open(path)
+		if err != nil {
+			b.Fatalf("unexpected error: %s", err)
+		}
+		info, err := file.Stat()
+		if err == nil {
+			err = androidMSIE.runParallel(file, info.Size(), textOutput, ioutil.Discard, 4)
+		}
+		file.Close()
+		if err != nil {
+			b.Fatalf("unexpected error: %s", err)
+		}
+	}
+}
+
+func BenchmarkReport(b *testing.B) {
+	opts := options{path: benchFile(), format: reportText, top: 3}
+	for i := 0; i < b.N; i++ {
+		if err := report(ioutil.Discard, opts); err != nil {
+			b.Fatalf("unexpected error: %s", err)
+		}
+	}
+}
+
+func TestParseArgsBench(t *testing.T) {
+	opts, err := parseArgs([]string{"bench", "-update", "-threshold", "0.1", "-profile", "prof"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if opts.command != commandBench || !opts.update || opts.threshold != 0.1 || opts.profile != "prof" ||
+		opts.path != filePath || opts.baseline != "bench.txt" || opts.count != 3 {
+		t.Errorf("wrong args: %+v", opts)
+	}
+	for _, args := range [][]string{{"bench", "-count", "0"}, {"bench", "-q", "x"}, {"bench", "a", "b"}} {
+		if _, err := parseArgs(args); err == nil {
+			t.Errorf("expected error for %q", args)
+		}
+	}
+}
@@ -2,17 +2,22 @@ package main
 
 import (
 	"io"
+	"os"
 )
 
-// вам надо написать более быструю оптимальную этой функции
+// androidMSIE is the question of SlowSearch.
+var androidMSIE = MustParseQuery(`browsers contains "Android" and browsers contains "MSIE"`)
+
+// FastSearch writes the same report as SlowSearch in a single pass over
+// the file, without decoding the users into maps.
 func FastSearch(out io.Writer) {
-	/*
-		!!! !!! !!!
-		обратите внимание - в задании обязательно нужен отчет
-		делать его лучше в самом начале, когда вы видите уже узкие места, но еще не оптимизировалм их
-		так же обратите внимание на команду в параметром -http
-		перечитайте еще раз задание
-		!!! !!! !!!
-	*/
-	SlowSearch(out)
+	file, err := os.Open(filePath)
+	if err != nil {
+		panic(err)
+	}
+	defer file.Close()
+
+	if err := androidMSIE.Run(file, out); err != nil {
+		panic(err)
+	}
 }
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// indexSuffix names the index of a file after it.
+const indexSuffix = ".idx"
+
+const indexVersion = 3
+
+var (
+	// ErrStaleIndex is returned for an index built before its file changed.
+	ErrStaleIndex = errors.New("index is stale")
+	// ErrNotIndexed is returned for a query on fields an index does not keep.
+	ErrNotIndexed = errors.New("query is not answered by the index")
+)
+
+// Index is an inverted index of the browsers of a file of users, kept
+// next to the file. It answers the queries on browsers, names and
+// emails without reading the file.
+type Index struct {
+	Version int `json:"version"`
+	// Size and ModTime are those of the file when it was indexed.
+	Size    int64 `json:"size"`
+	ModTime int64 `json:"mod_time"`
+
+	Users    []IndexUser    `json:"users"`
+	Browsers []IndexBrowser `json:"browsers"`
+	// Tokens are the browsers by the words of their user agents.
+	Tokens map[string][]int `json:"tokens"`
+	// Trigrams are the tokens by the runs of three bytes in them, to
+	// find the tokens containing a word without scanning them all.
+	Trigrams map[string][]string `json:"trigrams"`
+}
+
+// IndexUser is a line of the file. Offset is where it starts, in the
+// decompressed data for a gzip file.
+type IndexUser struct {
+	Line   int    `json:"line"`
+	Offset int64  `json:"offset"`
+	Name   string `json:"name"`
+	Email  string `json:"email"`
+}
+
+// IndexBrowser is a user agent and the users having it.
+type IndexBrowser struct {
+	Agent string `json:"agent"`
+	Users []int  `json:"users"`
+}
+
+// IndexPath returns the path of the index of the file at path.
+func IndexPath(path string) string {
+	return path + indexSuffix
+}
+
+// BuildIndex indexes the users of the file at path and writes the index
+// next to it.
+func BuildIndex(path string) (*Index, error) {
+	in, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	ix, err := buildIndex(in)
+	if err != nil {
+		return nil, err
+	}
+	ix.Size, ix.ModTime = info.Size(), info.ModTime().UnixNano()
+	return ix, ix.write(IndexPath(path))
+}
+
+func buildIndex(in io.Reader) (*Index, error) {
+	in, err := decompress(in)
+	if err != nil {
+		return nil, err
+	}
+	var offset, lineStart int64
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+	scanner.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		advance, token, err := bufio.ScanLines(data, atEOF)
+		if token != nil {
+			lineStart = offset
+			offset += int64(advance)
+		}
+		return advance, token, err
+	})
+
+	ix := &Index{Version: indexVersion, Tokens: map[string][]int{}}
+	browsers := map[string]int{}
+	u := newUser(fieldBrowsers, fieldName, fieldEmail)
+	for i := 0; scanner.Scan(); i++ {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		if err := u.unmarshal(line); err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		id := len(ix.Users)
+		ix.Users = append(ix.Users, IndexUser{Line: i, Offset: lineStart, Name: string(u.name), Email: string(u.email)})
+		for _, agent := range u.browsers {
+			b, ok := browsers[string(agent)]
+			if !ok {
+				b = len(ix.Browsers)
+				browsers[string(agent)] = b
+				ix.Browsers = append(ix.Browsers, IndexBrowser{Agent: string(agent)})
+				for _, token := range agentTokens(string(agent)) {
+					ix.Tokens[token] = append(ix.Tokens[token], b)
+				}
+			}
+			// a user having a browser twice is listed once
+			users := ix.Browsers[b].Users
+			if len(users) == 0 || users[len(users)-1] != id {
+				ix.Browsers[b].Users = append(users, id)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	ix.Trigrams = tokenTrigrams(ix.Tokens)
+	return ix, nil
+}
+
+// tokenTrigrams lists every token under each of its trigrams, sorted.
+// Tokens shorter than a trigram are not listed.
+func tokenTrigrams(tokens map[string][]int) map[string][]string {
+	trigrams := map[string][]string{}
+	for token := range tokens {
+		seen := map[string]bool{}
+		for i := 0; i+3 <= len(token); i++ {
+			t := token[i : i+3]
+			if !seen[t] {
+				seen[t] = true
+				trigrams[t] = append(trigrams[t], token)
+			}
+		}
+	}
+	for _, list := range trigrams {
+		sort.Strings(list)
+	}
+	return trigrams
+}
+
+// agentTokens returns the distinct words of agent: its runs of ASCII
+// letters and digits.
+func agentTokens(agent string) []string {
+	words := strings.FieldsFunc(agent, func(r rune) bool { return !isTokenRune(r) })
+	sort.Strings(words)
+	tokens := words[:0]
+	for i, w := range words {
+		if i == 0 || w != words[i-1] {
+			tokens = append(tokens, w)
+		}
+	}
+	return tokens
+}
+
+func isTokenRune(r rune) bool {
+	return 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9'
+}
+
+// write replaces the index at path, so that it is never read half written.
+func (ix *Index) write(path string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return err
+	}
+	w := bufio.NewWriter(tmp)
+	if err := json.NewEncoder(w).Encode(ix); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// OpenIndex reads the index of the file at path. It returns
+// ErrStaleIndex if the file changed size or modification time since it
+// was indexed.
+func OpenIndex(path string) (*Index, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(IndexPath(path))
+	if err != nil {
+		return nil, err
+	}
+	ix := &Index{}
+	if err := json.Unmarshal(data, ix); err != nil {
+		return nil, fmt.Errorf("%s: %w", IndexPath(path), err)
+	}
+	if ix.Version != indexVersion || ix.Size != info.Size() || ix.ModTime != info.ModTime().UnixNano() {
+		return nil, ErrStaleIndex
+	}
+	return ix, nil
+}
+
+// indexed reports whether an index answers q written as o says: the
+// phones are not indexed.
+func (q *Query) indexed(o *output) bool {
+	if o.phone != policyDrop {
+		return false
+	}
+	for _, p := range q.preds {
+		if p.field != fieldBrowsers && p.field != fieldName && p.field != fieldEmail {
+			return false
+		}
+	}
+	return true
+}
+
+// RunIndexed writes the report of Run from the index of the file.
+// Queries on other fields than browsers, name and email return
+// ErrNotIndexed.
+func (q *Query) RunIndexed(ix *Index, out io.Writer) error {
+	return q.runIndexed(ix, textOutput, out)
+}
+
+// runIndexed is RunIndexed writing the users found as o says.
+func (q *Query) runIndexed(ix *Index, o *output, out io.Writer) error {
+	if !q.indexed(o) {
+		return ErrNotIndexed
+	}
+
+	// the users having a browser matching each browsers predicate
+	having := make([][]bool, len(q.preds))
+	seen := make([]bool, len(ix.Browsers))
+	for i := range q.preds {
+		p := &q.preds[i]
+		if p.field != fieldBrowsers {
+			continue
+		}
+		having[i] = make([]bool, len(ix.Users))
+		for _, b := range ix.candidates(p) {
+			if !p.match([]byte(ix.Browsers[b].Agent)) {
+				continue
+			}
+			seen[b] = true
+			for _, u := range ix.Browsers[b].Users {
+				having[i][u] = true
+			}
+		}
+	}
+
+	rw := o.writer(out)
+	results := make([]bool, len(q.preds))
+	u := &user{}
+	for id, iu := range ix.Users {
+		u.name, u.email = append(u.name[:0], iu.Name...), append(u.email[:0], iu.Email...)
+		for i := range q.preds {
+			if having[i] != nil {
+				results[i] = having[i][id]
+			} else {
+				results[i] = q.preds[i].match(*u.field(q.preds[i].field))
+			}
+		}
+		if q.root.eval(results) {
+			rw.user(iu.Line, u)
+		}
+	}
+	unique := 0
+	for _, s := range seen {
+		if s {
+			unique++
+		}
+	}
+	return rw.end(unique)
+}
+
+// candidates returns the browsers which may match p. A contains of a
+// word is in the browsers having a token containing it, others can be
+// in any browser.
+func (ix *Index) candidates(p *predicate) []int {
+	word := p.kind == matchContains && len(p.value) > 0 &&
+		strings.IndexFunc(string(p.value), func(r rune) bool { return !isTokenRune(r) }) < 0
+	if !word {
+		all := make([]int, len(ix.Browsers))
+		for b := range all {
+			all[b] = b
+		}
+		return all
+	}
+
+	found := map[int]bool{}
+	for _, token := range ix.tokensContaining(string(p.value)) {
+		for _, b := range ix.Tokens[token] {
+			found[b] = true
+		}
+	}
+	candidates := make([]int, 0, len(found))
+	for b := range found {
+		candidates = append(candidates, b)
+	}
+	return candidates
+}
+
+// tokensContaining returns the tokens containing word: those of the
+// rarest trigram of word which do. A word shorter than a trigram is
+// searched for in all the tokens.
+func (ix *Index) tokensContaining(word string) []string {
+	var tokens []string
+	if len(word) < 3 {
+		for token := range ix.Tokens {
+			if strings.Contains(token, word) {
+				tokens = append(tokens, token)
+			}
+		}
+		return tokens
+	}
+	// the shortest list of the trigrams, checked against the word
+	shortest := ix.Trigrams[word[:3]]
+	for i := 1; i+3 <= len(word); i++ {
+		if list := ix.Trigrams[word[i:i+3]]; len(list) < len(shortest) {
+			shortest = list
+		}
+	}
+	for _, token := range shortest {
+		if strings.Contains(token, word) {
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens
+}
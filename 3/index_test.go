@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// copyUsers copies the users, with data after them, to a new file
+func copyUsers(t *testing.T, extra string) string {
+	t.Helper()
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	path := filepath.Join(t.TempDir(), "users.txt")
+	if err := ioutil.WriteFile(path, append(data, extra...), 0o644); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	return path
+}
+
+// the candidates of a word are the browsers containing it, found by
+// the trigrams of the tokens or, for short words, in all the tokens
+func TestIndexCandidates(t *testing.T) {
+	path := copyUsers(t, "\n"+`{"browsers":["Foo/1 (MSIEX; Androids)"],"name":"A","email":"a@b"}`+"\n")
+	ix, err := BuildIndex(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if list := ix.Trigrams["IEX"]; !reflect.DeepEqual(list, []string{"MSIEX"}) {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", list, []string{"MSIEX"})
+	}
+	for _, word := range []string{"MSIE", "Android", "MSIEX", "ndroi", "Chrome", "zzz", "5", "10", "IE"} {
+		p := &predicate{field: fieldBrowsers, kind: matchContains, value: []byte(word)}
+		got := ix.candidates(p)
+		sort.Ints(got)
+		expected := []int{}
+		for b, browser := range ix.Browsers {
+			if strings.Contains(browser.Agent, word) {
+				expected = append(expected, b)
+			}
+		}
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("results not match for %s\nGot:\n%v\nExpected:\n%v", word, got, expected)
+		}
+	}
+}
+
+func TestRunIndexed(t *testing.T) {
+	extra := "\n\n" + `{"browsers":["Mozilla/5.0 (Linux; Android 9) MSIE-like","Opera\/9","Opera/9"],"name":"A \"B\"","email":"a@b"}` + "\r\n"
+	path := copyUsers(t, extra)
+	ix, err := BuildIndex(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	data, _ := ioutil.ReadFile(path)
+
+	for _, text := range []string{
+		androidMSIE.String(),
+		`browsers contains "MSIE" or browsers contains "Android"`,
+		`browsers contains "Android 4" and not browsers matches "Chrome/[0-9]+"`,
+		`browsers = "Opera/9" and name contains "B"`,
+		`email matches "\\.gov$" or browsers contains "ndroi"`,
+		`not browsers contains "e"`,
+	} {
+		q := MustParseQuery(text)
+		expected, err := runSequential(t, q, data)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		out := &bytes.Buffer{}
+		if err := q.RunIndexed(ix, out); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if out.String() != expected {
+			t.Errorf("results not match for %s\nGot:\n%v\nExpected:\n%v", q, out, expected)
+		}
+	}
+
+	err = MustParseQuery(`country = "Kenya"`).RunIndexed(ix, &bytes.Buffer{})
+	if !errors.Is(err, ErrNotIndexed) {
+		t.Errorf("wrong error\nGot: %v\nExpected: %v", err, ErrNotIndexed)
+	}
+}
+
+func TestIndexOffsets(t *testing.T) {
+	path := copyUsers(t, "")
+	ix, err := BuildIndex(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	data, _ := ioutil.ReadFile(path)
+	lines := strings.Split(string(data), "\n")
+	for _, u := range ix.Users {
+		if !strings.HasPrefix(string(data[u.Offset:]), lines[u.Line]) {
+			t.Errorf("wrong offset %d of line %d", u.Offset, u.Line)
+		}
+	}
+}
+
+func TestOpenIndexStale(t *testing.T) {
+	path := copyUsers(t, "")
+	if _, err := OpenIndex(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("wrong error\nGot: %v\nExpected: %v", err, os.ErrNotExist)
+	}
+	if _, err := BuildIndex(path); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := OpenIndex(path); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	later := time.Now().Add(time.Hour)
+	os.Chtimes(path, later, later)
+	if _, err := OpenIndex(path); !errors.Is(err, ErrStaleIndex) {
+		t.Errorf("wrong error\nGot: %v\nExpected: %v", err, ErrStaleIndex)
+	}
+}
+
+// a stale index is not used, the file is searched instead
+func TestSearchIndexed(t *testing.T) {
+	path := copyUsers(t, "")
+	if err := index(ioutil.Discard, options{path: path}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// the index answers without reading the file, which looks the same
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	ioutil.WriteFile(path, bytes.Repeat([]byte(" "), int(info.Size())), 0o644)
+	os.Chtimes(path, info.ModTime(), info.ModTime())
+	out := &bytes.Buffer{}
+	if err := search(out, options{path: path, query: androidMSIE, shards: 1}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if expected := slowReport(); out.String() != expected {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", out, expected)
+	}
+
+	// once the file changes the index is stale
+	ioutil.WriteFile(path, []byte(`{"browsers":["MSIE Android"],"name":"a","email":"a@b"}`+"\n"), 0o644)
+	out.Reset()
+	if err := search(out, options{path: path, query: androidMSIE, shards: 1}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if expected := "found users:\n[0] a <a [at] b>\n\nTotal unique browsers 1\n"; out.String() != expected {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", out, expected)
+	}
+}
+
+func TestParseArgsIndex(t *testing.T) {
+	opts, err := parseArgs([]string{"index"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if opts.command != commandIndex || opts.path != filePath {
+		t.Errorf("wrong args: %+v", opts)
+	}
+	if _, err := parseArgs([]string{"index", "a", "b"}); err == nil {
+		t.Errorf("expected error for %q", []string{"index", "a", "b"})
+	}
+}
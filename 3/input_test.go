@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func slowReport() string {
+	out := &bytes.Buffer{}
+	SlowSearch(out)
+	return out.String()
+}
+
+func TestRunGzip(t *testing.T) {
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	compressed := &bytes.Buffer{}
+	zw := gzip.NewWriter(compressed)
+	zw.Write(data)
+	zw.Close()
+
+	out := &bytes.Buffer{}
+	if err := androidMSIE.Run(compressed, out); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if expected := slowReport(); out.String() != expected {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", out, expected)
+	}
+}
+
+func TestSearchStdin(t *testing.T) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer file.Close()
+	stdin := os.Stdin
+	defer func() { os.Stdin = stdin }()
+	os.Stdin = file
+
+	opts, err := parseArgs(nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	out := &bytes.Buffer{}
+	if err := search(out, opts); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if expected := slowReport(); out.String() != expected {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", out, expected)
+	}
+}
+
+func TestParseArgs(t *testing.T) {
+	opts, err := parseArgs([]string{"-q", `country = "Kenya"`, "-j", "3", "users.txt.gz"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if opts.path != "users.txt.gz" || opts.query.String() != `country = "Kenya"` || opts.shards != 3 {
+		t.Errorf("wrong args: %+v", opts)
+	}
+	for _, args := range [][]string{{"-q", "country"}, {"a", "b"}, {"-x"}, {"-j", "x"}} {
+		if _, err := parseArgs(args); err == nil {
+			t.Errorf("expected error for %q", args)
+		}
+	}
+}
+
+// repeatReader reads data n times, a newline after each
+type repeatReader struct {
+	data []byte
+	n    int
+	pos  int
+}
+
+func (r *repeatReader) Read(p []byte) (int, error) {
+	if r.n == 0 {
+		return 0, io.EOF
+	}
+	copied := 0
+	for copied < len(p) && r.n > 0 {
+		if r.pos == len(r.data) {
+			p[copied] = '\n'
+			copied++
+			r.pos = 0
+			r.n--
+			continue
+		}
+		c := copy(p[copied:], r.data[r.pos:])
+		r.pos += c
+		copied += c
+	}
+	return copied, nil
+}
+
+// ~100MB of users, nothing is kept but the unique browsers
+func TestRunConstantMemory(t *testing.T) {
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	in := &repeatReader{data: data, n: 200}
+
+	before := &runtime.MemStats{}
+	runtime.ReadMemStats(before)
+	// nothing is found, so the report is short
+	q := MustParseQuery(`browsers contains "Android" and name = "nobody"`)
+	out := &bytes.Buffer{}
+	if err := q.Run(in, out); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	after := &runtime.MemStats{}
+	runtime.ReadMemStats(after)
+
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 4<<20 {
+		t.Errorf("too much memory allocated for %dMB of input\nGot: %d\nExpected: <=%d",
+			len(data)*200>>20, allocated, 4<<20)
+	}
+	if !strings.HasPrefix(out.String(), "found users:\n\nTotal unique browsers ") {
+		t.Errorf("wrong report:\n%s", out)
+	}
+}
+
+func TestRunLongLine(t *testing.T) {
+	in := strings.NewReader(`{"name":"` + strings.Repeat("x", maxLineSize))
+	err := androidMSIE.Run(in, ioutil.Discard)
+	if !errors.Is(err, bufio.ErrTooLong) {
+		t.Errorf("wrong error\nGot: %v\nExpected: %v", err, bufio.ErrTooLong)
+	}
+}
+
+func TestOpenInputMissing(t *testing.T) {
+	err := search(ioutil.Discard, options{path: filepath.Join(t.TempDir(), "none"), query: androidMSIE})
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("wrong error\nGot: %v\nExpected: %v", err, os.ErrNotExist)
+	}
+}
@@ -0,0 +1,345 @@
+// Package jsonscan reads chosen fields of JSON objects, such as the
+// lines of a JSON-lines file, without allocating: values are returned
+// as parts of the line, or of a buffer reused from line to line when
+// they have to be unescaped. Other keys are skipped without being
+// decoded.
+package jsonscan
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Kind is the type of the value of a field.
+type Kind int
+
+const (
+	// String is a JSON string.
+	String Kind = iota
+	// Strings is a JSON array of strings.
+	Strings
+)
+
+// Field is a key to read and the type of its value.
+type Field struct {
+	Name string
+	Kind Kind
+}
+
+// Scanner reads the fields it was made with from one object at a time.
+// The values are valid until the next Scan.
+type Scanner struct {
+	fields []Field
+	values [][]byte
+	arrays [][][]byte
+	buf    []byte // the unescaped strings
+
+	data []byte
+	pos  int
+}
+
+// NewScanner returns a scanner of the given fields. The values are
+// then found by the index of their field.
+func NewScanner(fields ...Field) *Scanner {
+	return &Scanner{
+		fields: fields,
+		values: make([][]byte, len(fields)),
+		arrays: make([][][]byte, len(fields)),
+	}
+}
+
+// Bytes returns the string of field i, nil if it was missing.
+func (s *Scanner) Bytes(i int) []byte {
+	return s.values[i]
+}
+
+// Strings returns the strings of the array of field i, none if it was
+// missing.
+func (s *Scanner) Strings(i int) [][]byte {
+	return s.arrays[i]
+}
+
+// Scan reads the object of data. The fields missing from it are reset,
+// a field found twice has its last value.
+func (s *Scanner) Scan(data []byte) error {
+	for i := range s.fields {
+		s.values[i] = nil
+		s.arrays[i] = s.arrays[i][:0]
+	}
+	s.buf = s.buf[:0]
+	s.data, s.pos = data, 0
+
+	if err := s.expect('{'); err != nil {
+		return err
+	}
+	if s.skipSpace() == '}' {
+		s.pos++
+		return s.end()
+	}
+	for {
+		key, err := s.str()
+		if err != nil {
+			return err
+		}
+		if err := s.expect(':'); err != nil {
+			return err
+		}
+		if err := s.value(key); err != nil {
+			return err
+		}
+
+		switch s.skipSpace() {
+		case ',':
+			s.pos++
+		case '}':
+			s.pos++
+			return s.end()
+		default:
+			return s.errorf("expected , or }")
+		}
+	}
+}
+
+// value reads the value of key if it is a field, skips it otherwise.
+func (s *Scanner) value(key []byte) error {
+	for i := range s.fields {
+		if string(key) != s.fields[i].Name {
+			continue
+		}
+		if s.fields[i].Kind == Strings {
+			return s.array(i)
+		}
+		v, err := s.str()
+		s.values[i] = v
+		return err
+	}
+	return s.skipValue()
+}
+
+func (s *Scanner) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("offset %d: %s", s.pos, fmt.Sprintf(format, args...))
+}
+
+// skipSpace moves to the next non-space byte and returns it, 0 at the end.
+func (s *Scanner) skipSpace() byte {
+	for ; s.pos < len(s.data); s.pos++ {
+		switch c := s.data[s.pos]; c {
+		case ' ', '\t', '\n', '\r':
+		default:
+			return c
+		}
+	}
+	return 0
+}
+
+func (s *Scanner) expect(c byte) error {
+	if s.skipSpace() != c {
+		return s.errorf("expected %c", c)
+	}
+	s.pos++
+	return nil
+}
+
+func (s *Scanner) end() error {
+	if s.skipSpace() != 0 {
+		return s.errorf("unexpected data after object")
+	}
+	return nil
+}
+
+// str reads a string. It is a part of data unless it has to be
+// unescaped into buf.
+func (s *Scanner) str() ([]byte, error) {
+	raw, plain, err := s.scanString()
+	if err != nil || plain {
+		return raw, err
+	}
+	start := len(s.buf)
+	if s.buf, err = unquote(s.buf, raw); err != nil {
+		s.pos -= len(raw) + 1
+		return nil, s.errorf("%s", err)
+	}
+	return s.buf[start:len(s.buf):len(s.buf)], nil
+}
+
+// scanString moves past a string and returns what is between its
+// quotes. It is plain if it has no escapes and is valid UTF-8.
+func (s *Scanner) scanString() (raw []byte, plain bool, err error) {
+	if err := s.expect('"'); err != nil {
+		return nil, false, err
+	}
+	start := s.pos
+	plain = true
+	for s.pos < len(s.data) {
+		switch c := s.data[s.pos]; {
+		case c == '"':
+			s.pos++
+			return s.data[start : s.pos-1], plain, nil
+		case c == '\\':
+			plain = false
+			s.pos += 2
+		case c < ' ':
+			return nil, false, s.errorf("control character in string")
+		case c < utf8.RuneSelf:
+			s.pos++
+		default:
+			r, size := utf8.DecodeRune(s.data[s.pos:])
+			if r == utf8.RuneError && size == 1 {
+				plain = false
+			}
+			s.pos += size
+		}
+	}
+	return nil, false, s.errorf("unterminated string")
+}
+
+// array reads an array of strings into the values of field i.
+func (s *Scanner) array(i int) error {
+	s.arrays[i] = s.arrays[i][:0]
+	if err := s.expect('['); err != nil {
+		return err
+	}
+	if s.skipSpace() == ']' {
+		s.pos++
+		return nil
+	}
+	for {
+		v, err := s.str()
+		if err != nil {
+			return err
+		}
+		s.arrays[i] = append(s.arrays[i], v)
+		switch s.skipSpace() {
+		case ',':
+			s.pos++
+		case ']':
+			s.pos++
+			return nil
+		default:
+			return s.errorf("expected , or ]")
+		}
+	}
+}
+
+// skipValue moves past a value of any type.
+func (s *Scanner) skipValue() error {
+	switch s.skipSpace() {
+	case '"':
+		_, _, err := s.scanString()
+		return err
+	case '[', '{':
+		depth := 0
+		for s.pos < len(s.data) {
+			switch s.data[s.pos] {
+			case '[', '{':
+				depth++
+			case ']', '}':
+				depth--
+				if depth == 0 {
+					s.pos++
+					return nil
+				}
+			case '"':
+				if _, _, err := s.scanString(); err != nil {
+					return err
+				}
+				continue
+			}
+			s.pos++
+		}
+		return s.errorf("unterminated value")
+	}
+	start := s.pos
+	for s.pos < len(s.data) && strings.IndexByte(",]} \t\r\n", s.data[s.pos]) < 0 {
+		s.pos++
+	}
+	if s.pos == start {
+		return s.errorf("expected value")
+	}
+	return nil
+}
+
+// unquote appends raw unescaped to buf the way encoding/json does:
+// invalid UTF-8 and lone surrogates become U+FFFD.
+func unquote(buf, raw []byte) ([]byte, error) {
+	for i := 0; i < len(raw); {
+		c := raw[i]
+		if c >= utf8.RuneSelf {
+			r, size := utf8.DecodeRune(raw[i:])
+			buf = utf8.AppendRune(buf, r)
+			i += size
+			continue
+		}
+		if c != '\\' {
+			buf = append(buf, c)
+			i++
+			continue
+		}
+		if i+1 == len(raw) {
+			return buf, fmt.Errorf("unterminated escape")
+		}
+		switch e := raw[i+1]; e {
+		case '"', '\\', '/':
+			buf = append(buf, e)
+		case 'b':
+			buf = append(buf, '\b')
+		case 'f':
+			buf = append(buf, '\f')
+		case 'n':
+			buf = append(buf, '\n')
+		case 'r':
+			buf = append(buf, '\r')
+		case 't':
+			buf = append(buf, '\t')
+		case 'u':
+			r, ok := hex4(raw[i+2:])
+			if !ok {
+				return buf, fmt.Errorf("invalid escape \\u")
+			}
+			i += 6
+			if utf16.IsSurrogate(r) {
+				// a pair, or a lone surrogate
+				dec := utf8.RuneError
+				if len(raw) >= i+6 && raw[i] == '\\' && raw[i+1] == 'u' {
+					if r2, ok := hex4(raw[i+2:]); ok {
+						dec = utf16.DecodeRune(r, r2)
+					}
+				}
+				if dec != utf8.RuneError {
+					i += 6
+				}
+				r = dec
+			}
+			buf = utf8.AppendRune(buf, r)
+			continue
+		default:
+			return buf, fmt.Errorf("invalid escape \\%c", e)
+		}
+		i += 2
+	}
+	return buf, nil
+}
+
+// hex4 reads the 4 hex digits b starts with.
+func hex4(b []byte) (rune, bool) {
+	if len(b) < 4 {
+		return 0, false
+	}
+	var r rune
+	for _, c := range b[:4] {
+		switch {
+		case '0' <= c && c <= '9':
+			c -= '0'
+		case 'a' <= c && c <= 'f':
+			c -= 'a' - 10
+		case 'A' <= c && c <= 'F':
+			c -= 'A' - 10
+		default:
+			return 0, false
+		}
+		r = r<<4 | rune(c)
+	}
+	return r, true
+}
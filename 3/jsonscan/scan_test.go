@@ -0,0 +1,261 @@
+package jsonscan
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+const usersPath = "../data/users.txt"
+
+const (
+	fieldBrowsers = iota
+	fieldName
+	fieldEmail
+)
+
+func newUserScanner() *Scanner {
+	return NewScanner(
+		Field{Name: "browsers", Kind: Strings},
+		Field{Name: "name", Kind: String},
+		Field{Name: "email", Kind: String},
+	)
+}
+
+// jsonUser is what the scanner is compared with
+type jsonUser struct {
+	Browsers []string `json:"browsers"`
+	Name     string   `json:"name"`
+	Email    string   `json:"email"`
+}
+
+func readLines(tb testing.TB) [][]byte {
+	data, err := ioutil.ReadFile(usersPath)
+	if err != nil {
+		tb.Fatalf("unexpected error: %s", err)
+	}
+	return bytes.Split(bytes.TrimSpace(data), []byte("\n"))
+}
+
+func scanned(s *Scanner) jsonUser {
+	u := jsonUser{Name: string(s.Bytes(fieldName)), Email: string(s.Bytes(fieldEmail))}
+	for _, b := range s.Strings(fieldBrowsers) {
+		u.Browsers = append(u.Browsers, string(b))
+	}
+	return u
+}
+
+func TestScanUsers(t *testing.T) {
+	s := newUserScanner()
+	for i, line := range readLines(t) {
+		expected := jsonUser{}
+		if err := json.Unmarshal(line, &expected); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if err := s.Scan(line); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if got := scanned(s); fmt.Sprint(got) != fmt.Sprint(expected) {
+			t.Errorf("results not match on line %d\nGot:\n%v\nExpected:\n%v", i+1, got, expected)
+		}
+	}
+}
+
+func TestScan(t *testing.T) {
+	s := newUserScanner()
+	line := ` { "name" : "A \"B\" é😀", "age": 30, "tags": {"x": [1, "]\"}"]},
+		"browsers": ["x", "y\/z\t"], "email": "a@b", "ok": true, "name2": "c" } `
+	if err := s.Scan([]byte(line)); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := jsonUser{Name: "A \"B\" é😀", Email: "a@b", Browsers: []string{"x", "y/z\t"}}
+	if got := scanned(s); fmt.Sprint(got) != fmt.Sprint(expected) {
+		t.Errorf("results not match\nGot:\n%q\nExpected:\n%q", got, expected)
+	}
+
+	// the fields of the previous object are reset, duplicates have the last value
+	if err := s.Scan([]byte(`{"browsers":["a"],"browsers":[],"email":"a","email":""}`)); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if s.Bytes(fieldName) != nil || s.Bytes(fieldEmail) == nil || len(s.Bytes(fieldEmail)) != 0 || len(s.Strings(fieldBrowsers)) != 0 {
+		t.Errorf("fields not reset: name %q, email %q, browsers %q",
+			s.Bytes(fieldName), s.Bytes(fieldEmail), s.Strings(fieldBrowsers))
+	}
+}
+
+func TestScanErrors(t *testing.T) {
+	s := newUserScanner()
+	for _, bad := range []string{
+		``, `[]`, `{"name"}`, `{"name":"a"`, `{"name":"a"} x`, `{"browsers":"a"}`,
+		`{"name":1}`, `{"browsers":[1]}`, `{"name":"\x"}`, `{"name":"\u12"}`,
+		"{\"name\":\"a\x01\"}", `{"x":[}`, `{"x":}`,
+	} {
+		if err := s.Scan([]byte(bad)); err == nil {
+			t.Errorf("expected error for %s", bad)
+		}
+	}
+}
+
+func TestScanAllocs(t *testing.T) {
+	lines := append(readLines(t), []byte(`{"name":"A\n","browsers":["\"x\""]}`))
+	s := newUserScanner()
+	scan := func() {
+		for _, line := range lines {
+			if err := s.Scan(line); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+		}
+	}
+	scan()
+	if allocs := testing.AllocsPerRun(10, scan); allocs != 0 {
+		t.Errorf("scan allocates\nGot: %v\nExpected: 0", allocs)
+	}
+}
+
+// reference reads the user of line with encoding/json. A field of the
+// wrong type is an error, as for the scanner.
+func reference(line []byte) (jsonUser, error) {
+	u := jsonUser{}
+	dec := json.NewDecoder(bytes.NewReader(line))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return u, fmt.Errorf("expected object")
+	}
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return u, err
+		}
+		raw := json.RawMessage{}
+		if err := dec.Decode(&raw); err != nil {
+			return u, err
+		}
+		switch key {
+		case "name", "email":
+			if raw[0] != '"' {
+				return u, fmt.Errorf("%s is not a string", key)
+			}
+			field := &u.Name
+			if key == "email" {
+				field = &u.Email
+			}
+			if err := json.Unmarshal(raw, field); err != nil {
+				return u, err
+			}
+		case "browsers":
+			var items []json.RawMessage
+			if err := json.Unmarshal(raw, &items); err != nil || raw[0] != '[' {
+				return u, fmt.Errorf("browsers is not an array")
+			}
+			u.Browsers = u.Browsers[:0]
+			for _, item := range items {
+				var b string
+				if item[0] != '"' || json.Unmarshal(item, &b) != nil {
+					return u, fmt.Errorf("browsers is not an array of strings")
+				}
+				u.Browsers = append(u.Browsers, b)
+			}
+		}
+	}
+	if _, err := dec.Token(); err != nil {
+		return u, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return u, fmt.Errorf("unexpected data after object")
+	}
+	return u, nil
+}
+
+// the scanner reads what encoding/json does from any object it accepts
+func FuzzScan(f *testing.F) {
+	for _, line := range readLines(f)[:10] {
+		f.Add(line)
+	}
+	f.Add([]byte(`{"name":"😀\ud800x","email":"é\"","browsers":["\\", "a\/b"]}`))
+	f.Add([]byte("{\"name\":\"\xff\xfe\",\"x\":[{\"y\":\"]\"}],\"browsers\":[]}"))
+
+	s := newUserScanner()
+	f.Fuzz(func(t *testing.T, line []byte) {
+		expected, err := reference(line)
+		if err != nil {
+			return
+		}
+		if err := s.Scan(line); err != nil {
+			t.Fatalf("unexpected error for %q: %s", line, err)
+		}
+		if got := scanned(s); fmt.Sprintf("%q", got) != fmt.Sprintf("%q", expected) {
+			t.Errorf("results not match for %q\nGot:\n%q\nExpected:\n%q", line, got, expected)
+		}
+	})
+}
+
+// escapeAll writes every rune of s as \u escapes
+func escapeAll(s string) string {
+	b := &strings.Builder{}
+	b.WriteByte('"')
+	for _, r := range s {
+		for _, c := range utf16.Encode([]rune{r}) {
+			fmt.Fprintf(b, `\u%04x`, c)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// any string encoded by encoding/json, or fully escaped, reads back the same
+func FuzzScanString(f *testing.F) {
+	for _, s := range []string{"", "a", `"\/`, "\t\n\x00", "é😀", "\xff\xed\xa0\x80", "<&>"} {
+		f.Add(s)
+	}
+
+	s := newUserScanner()
+	f.Fuzz(func(t *testing.T, str string) {
+		marshaled, _ := json.Marshal(str)
+		expected := ""
+		if err := json.Unmarshal(marshaled, &expected); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		for _, quoted := range []string{string(marshaled), escapeAll(str)} {
+			line := fmt.Sprintf(`{"name":%s,"browsers":[%s,"x"],"other":%[1]s}`, quoted, quoted)
+			if err := s.Scan([]byte(line)); err != nil {
+				t.Fatalf("unexpected error for %s: %s", line, err)
+			}
+			name, browsers := string(s.Bytes(fieldName)), s.Strings(fieldBrowsers)
+			if name != expected || len(browsers) != 2 || string(browsers[0]) != expected {
+				t.Errorf("results not match for %s\nGot:\n%q %q\nExpected:\n%q", line, name, browsers, expected)
+			}
+		}
+	})
+}
+
+// go test -bench . -benchmem: the scanner against decoding the same
+// fields into a struct
+func BenchmarkScan(b *testing.B) {
+	lines := readLines(b)
+	s := newUserScanner()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		for _, line := range lines {
+			if err := s.Scan(line); err != nil {
+				b.Fatalf("unexpected error: %s", err)
+			}
+		}
+	}
+}
+
+func BenchmarkUnmarshal(b *testing.B) {
+	lines := readLines(b)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		for _, line := range lines {
+			u := jsonUser{}
+			if err := json.Unmarshal(line, &u); err != nil {
+				b.Fatalf("unexpected error: %s", err)
+			}
+		}
+	}
+}
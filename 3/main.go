@@ -0,0 +1,191 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+)
+
+// Usage:
+//
+//	hw3 [-q query] [-j shards] [-o text|json|csv] [-f template] [-email policy] [-phone policy] [file]
+//	hw3 report [-o text|csv|json] [-top n] [file]
+//	hw3 index [file]
+//	hw3 bench [-baseline file] [-update] [-threshold f] [-count n] [-benchtime d] [-profile dir] [file]
+//
+// Searches the users of file, stdin if it is "-" or missing, plain
+// or gzip-compressed, and prints the report of SlowSearch, from the
+// index of file if it is up to date. The found users can be written as
+// JSON, CSV or with a text/template instead, their emails and phones
+// plain, with " [at] ", masked, hashed with the secret key in
+// $HW3_HASH_KEY or dropped. The report command prints the analytics of
+// their browsers instead. The index command indexes file, the bench
+// command checks its searches against a baseline, both reading
+// data/users.txt if it is missing. The benchmarks are run with go test
+// -bench, so bench has to be run in the sources of hw3.
+func main() {
+	opts, err := parseArgs(os.Args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if err := commands[opts.command](os.Stdout, opts); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+const (
+	commandSearch = "search"
+	commandReport = "report"
+	commandIndex  = "index"
+	commandBench  = "bench"
+)
+
+var commands = map[string]func(out io.Writer, opts options) error{
+	commandSearch: search,
+	commandReport: report,
+	commandIndex:  index,
+	commandBench:  bench,
+}
+
+type options struct {
+	command string
+	path    string
+	query   *Query
+	shards  int
+	output  *output
+
+	format string
+	top    int
+
+	baseline  string
+	update    bool
+	threshold float64
+	count     int
+	benchtime string
+	profile   string
+}
+
+func parseArgs(args []string) (options, error) {
+	opts := options{command: commandSearch, path: "-", format: reportText, top: 3}
+	fs := flag.NewFlagSet("hw3", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	text := androidMSIE.String()
+	format, tmpl, email, phone := outputText, "", "at", "drop"
+	if len(args) > 0 && (args[0] == commandReport || args[0] == commandIndex || args[0] == commandBench) {
+		opts.command = args[0]
+		args = args[1:]
+	}
+	switch opts.command {
+	case commandReport:
+		fs.StringVar(&opts.format, "o", opts.format, "output format: text, csv or json")
+		fs.IntVar(&opts.top, "top", opts.top, "number of browser families per country, 0 for all")
+	case commandIndex:
+		opts.path = filePath
+	case commandBench:
+		opts.path = filePath
+		fs.StringVar(&opts.baseline, "baseline", "bench.txt", "file of the baseline results")
+		fs.BoolVar(&opts.update, "update", false, "write the results to the baseline instead of checking them")
+		fs.Float64Var(&opts.threshold, "threshold", 0.2, "largest growth of a result allowed, 0.2 for 20%")
+		fs.IntVar(&opts.count, "count", 3, "runs of each benchmark, the fastest is kept")
+		fs.StringVar(&opts.benchtime, "benchtime", "1s", "time or number of iterations of each run, as go test -benchtime")
+		fs.StringVar(&opts.profile, "profile", "", "directory to write CPU and heap profiles to")
+	default:
+		fs.StringVar(&text, "q", text, "query selecting the users")
+		fs.IntVar(&opts.shards, "j", runtime.GOMAXPROCS(0), "number of parts of a file searched in parallel")
+		fs.StringVar(&format, "o", format, "output format: text, json or csv")
+		fs.StringVar(&tmpl, "f", tmpl, "template written for every user, with .Line, .Name, .Email and .Phone")
+		fs.StringVar(&email, "email", email, "email policy: plain, at, mask, hash or drop, hash keyed by $"+hashKeyEnv)
+		fs.StringVar(&phone, "phone", phone, "phone policy: plain, at, mask, hash or drop, hash keyed by $"+hashKeyEnv)
+	}
+	if err := fs.Parse(args); err != nil {
+		return options{}, err
+	}
+	if fs.NArg() > 1 {
+		return options{}, errors.New("too many arguments")
+	}
+	if fs.NArg() == 1 {
+		opts.path = fs.Arg(0)
+	}
+	if _, ok := reportRenderers[opts.format]; !ok {
+		return options{}, fmt.Errorf("unknown output format %q", opts.format)
+	}
+	if opts.command == commandBench && opts.count < 1 {
+		return options{}, errors.New("count must be positive")
+	}
+	query, err := ParseQuery(text)
+	if err != nil {
+		return options{}, err
+	}
+	opts.query = query
+	if opts.output, err = newOutput(format, tmpl, email, phone, os.Getenv(hashKeyEnv)); err != nil {
+		return options{}, err
+	}
+	return opts, nil
+}
+
+// search runs the query over the input. A file with an up to date
+// index is not read, a regular one is searched in parallel, stdin is
+// read sequentially.
+func search(out io.Writer, opts options) error {
+	o := opts.output
+	if o == nil {
+		o = textOutput
+	}
+	if opts.path != "-" && opts.query.indexed(o) {
+		ix, err := OpenIndex(opts.path)
+		if err == nil {
+			return opts.query.runIndexed(ix, o, out)
+		}
+		if !errors.Is(err, ErrStaleIndex) && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	in, err := OpenInput(opts.path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	if file, ok := in.(*os.File); ok && opts.shards > 1 {
+		info, err := file.Stat()
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			return opts.query.runParallel(file, info.Size(), o, out, opts.shards)
+		}
+	}
+	return opts.query.run(in, o, out)
+}
+
+// report prints the analytics of the browsers of the users.
+func report(out io.Writer, opts options) error {
+	in, err := OpenInput(opts.path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	r, err := buildReport(in, opts.top)
+	if err != nil {
+		return err
+	}
+	return reportRenderers[opts.format](out, r)
+}
+
+// index writes the index of the file.
+func index(out io.Writer, opts options) error {
+	ix, err := BuildIndex(opts.path)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "indexed %d users, %d browsers, %d tokens in %s\n",
+		len(ix.Users), len(ix.Browsers), len(ix.Tokens), IndexPath(opts.path))
+	return nil
+}
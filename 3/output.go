@@ -0,0 +1,373 @@
+package main
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"text/template"
+)
+
+// policy is how a personal field of the found users is written.
+type policy int
+
+const (
+	// policyPlain writes the field as it is.
+	policyPlain policy = iota
+	// policyAt writes the @ of an email as " [at] ", as SlowSearch does.
+	policyAt
+	// policyMask hides most of the field: all but the first letter of
+	// the name of an email, all but the last two digits of a phone.
+	policyMask
+	// policyHash writes the start of the hex HMAC-SHA-256 of the field
+	// with the key of the output, to tell the users apart without
+	// showing it. Without the key a list of known emails or phones
+	// cannot be hashed to find the users.
+	policyHash
+	// policyDrop leaves the field out.
+	policyDrop
+)
+
+var policyNames = map[string]policy{
+	"plain": policyPlain,
+	"at":    policyAt,
+	"mask":  policyMask,
+	"hash":  policyHash,
+	"drop":  policyDrop,
+}
+
+// append appends the value of field f under the policy, hashed with
+// key for policyHash.
+func (p policy) append(buf []byte, f field, value []byte, key string) []byte {
+	switch p {
+	case policyAt:
+		for _, c := range value {
+			if c == '@' {
+				buf = append(buf, " [at] "...)
+			} else {
+				buf = append(buf, c)
+			}
+		}
+		return buf
+	case policyMask:
+		if f == fieldEmail {
+			return maskEmail(buf, value)
+		}
+		return maskDigits(buf, value)
+	case policyHash:
+		const digits = "0123456789abcdef"
+		mac := hmac.New(sha256.New, []byte(key))
+		mac.Write(value)
+		sum := mac.Sum(nil)
+		for _, c := range sum[:8] {
+			buf = append(buf, digits[c>>4], digits[c&0xf])
+		}
+		return buf
+	case policyDrop:
+		return buf
+	}
+	return append(buf, value...)
+}
+
+// maskEmail keeps the first letter of the name and the domain.
+func maskEmail(buf, email []byte) []byte {
+	at := len(email)
+	for i, c := range email {
+		if c == '@' {
+			at = i
+		}
+	}
+	if at > 0 {
+		buf = append(buf, email[0])
+	}
+	buf = append(buf, "***"...)
+	return append(buf, email[at:]...)
+}
+
+// maskDigits keeps the last two digits and what is not a digit.
+func maskDigits(buf, value []byte) []byte {
+	digits := 0
+	for _, c := range value {
+		if '0' <= c && c <= '9' {
+			digits++
+		}
+	}
+	for _, c := range value {
+		if '0' <= c && c <= '9' {
+			if digits > 2 {
+				c = '*'
+			}
+			digits--
+		}
+		buf = append(buf, c)
+	}
+	return buf
+}
+
+const (
+	outputText     = "text"
+	outputJSON     = "json"
+	outputCSV      = "csv"
+	outputTemplate = "template"
+)
+
+// hashKeyEnv is the environment variable holding the key of the hash
+// policy, kept out of the arguments so that it is not seen in ps.
+const hashKeyEnv = "HW3_HASH_KEY"
+
+// output is how the users found by a query are written.
+type output struct {
+	format   string
+	template *template.Template
+	email    policy
+	phone    policy
+	// key of the hash policy
+	key string
+}
+
+// textOutput is the report of SlowSearch.
+var textOutput = &output{format: outputText, email: policyAt, phone: policyDrop}
+
+// newOutput checks the format and policies given by name. A template
+// is the text of a text/template executed for every user, with Line,
+// Name, Email and Phone. The hash policy needs a key.
+func newOutput(format, text, email, phone, key string) (*output, error) {
+	o := &output{format: format, key: key}
+	if text != "" {
+		if format == outputText {
+			o.format = outputTemplate
+		}
+		t, err := template.New("user").Parse(text)
+		if err != nil {
+			return nil, err
+		}
+		o.template = t
+	}
+	if _, ok := resultWriters[o.format]; !ok {
+		return nil, fmt.Errorf("unknown output format %q", format)
+	}
+	if o.format == outputTemplate && o.template == nil {
+		return nil, fmt.Errorf("template output needs a template")
+	}
+	for _, p := range []struct {
+		name   string
+		policy *policy
+	}{{email, &o.email}, {phone, &o.phone}} {
+		policy, ok := policyNames[p.name]
+		if !ok {
+			return nil, fmt.Errorf("unknown policy %q", p.name)
+		}
+		*p.policy = policy
+	}
+	if (o.email == policyHash || o.phone == policyHash) && o.key == "" {
+		return nil, fmt.Errorf("hash policy needs a secret key in $%s", hashKeyEnv)
+	}
+	return o, nil
+}
+
+// fields returns the fields of the users o writes.
+func (o *output) fields() []field {
+	fields := []field{fieldName}
+	if o.email != policyDrop {
+		fields = append(fields, fieldEmail)
+	}
+	if o.phone != policyDrop {
+		fields = append(fields, fieldPhone)
+	}
+	return fields
+}
+
+// resultWriter writes the users found by a query, by their line, then
+// the number of unique browsers matched. The writes are buffered, end
+// flushes them.
+type resultWriter interface {
+	user(line int, u *user)
+	end(browsers int) error
+}
+
+var resultWriters = map[string]func(w *bufio.Writer, o *output) resultWriter{
+	outputText:     newTextResults,
+	outputJSON:     newJSONResults,
+	outputCSV:      newCSVResults,
+	outputTemplate: newTemplateResults,
+}
+
+func (o *output) writer(out io.Writer) resultWriter {
+	return resultWriters[o.format](bufio.NewWriter(out), o)
+}
+
+// textResults writes the lines "[i] name <email> phone" of the report
+// of SlowSearch, without the dropped fields.
+type textResults struct {
+	w   *bufio.Writer
+	o   *output
+	buf []byte
+}
+
+func newTextResults(w *bufio.Writer, o *output) resultWriter {
+	w.WriteString("found users:\n")
+	return &textResults{w: w, o: o}
+}
+
+func (r *textResults) user(line int, u *user) {
+	buf := appendIndex(r.buf[:0], line)
+	buf = append(buf, u.name...)
+	if r.o.email != policyDrop {
+		buf = append(buf, " <"...)
+		buf = r.o.email.append(buf, fieldEmail, u.email, r.o.key)
+		buf = append(buf, '>')
+	}
+	if r.o.phone != policyDrop {
+		buf = append(buf, ' ')
+		buf = r.o.phone.append(buf, fieldPhone, u.phone, r.o.key)
+	}
+	r.buf = append(buf, '\n')
+	r.w.Write(r.buf)
+}
+
+func (r *textResults) end(browsers int) error {
+	r.w.WriteString("\nTotal unique browsers ")
+	r.w.WriteString(strconv.Itoa(browsers))
+	r.w.WriteString("\n")
+	return r.w.Flush()
+}
+
+func appendIndex(buf []byte, i int) []byte {
+	buf = append(buf, '[')
+	buf = strconv.AppendInt(buf, int64(i), 10)
+	return append(buf, "] "...)
+}
+
+// resultUser is a found user of the JSON, CSV and template outputs,
+// the fields under their policies.
+type resultUser struct {
+	Line  int     `json:"line"`
+	Name  string  `json:"name"`
+	Email *string `json:"email,omitempty"`
+	Phone *string `json:"phone,omitempty"`
+}
+
+func (o *output) resultUser(line int, u *user) resultUser {
+	r := resultUser{Line: line, Name: string(u.name)}
+	if o.email != policyDrop {
+		email := string(o.email.append(nil, fieldEmail, u.email, o.key))
+		r.Email = &email
+	}
+	if o.phone != policyDrop {
+		phone := string(o.phone.append(nil, fieldPhone, u.phone, o.key))
+		r.Phone = &phone
+	}
+	return r
+}
+
+// jsonResults writes {"users":[...],"unique_browsers":n}, a user per line.
+type jsonResults struct {
+	w     *bufio.Writer
+	o     *output
+	users int
+}
+
+func newJSONResults(w *bufio.Writer, o *output) resultWriter {
+	w.WriteString(`{"users":[`)
+	return &jsonResults{w: w, o: o}
+}
+
+func (r *jsonResults) user(line int, u *user) {
+	if r.users > 0 {
+		r.w.WriteByte(',')
+	}
+	r.users++
+	r.w.WriteByte('\n')
+	data, _ := json.Marshal(r.o.resultUser(line, u))
+	r.w.Write(data)
+}
+
+func (r *jsonResults) end(browsers int) error {
+	fmt.Fprintf(r.w, "\n],\"unique_browsers\":%d}\n", browsers)
+	return r.w.Flush()
+}
+
+// csvResults writes a header and a row per user. The number of unique
+// browsers is left out.
+type csvResults struct {
+	w   *bufio.Writer
+	cw  *csv.Writer
+	o   *output
+	row []string
+}
+
+func newCSVResults(w *bufio.Writer, o *output) resultWriter {
+	r := &csvResults{w: w, cw: csv.NewWriter(w), o: o}
+	header := []string{"line", "name"}
+	if o.email != policyDrop {
+		header = append(header, "email")
+	}
+	if o.phone != policyDrop {
+		header = append(header, "phone")
+	}
+	r.cw.Write(header)
+	return r
+}
+
+func (r *csvResults) user(line int, u *user) {
+	ru := r.o.resultUser(line, u)
+	r.row = append(r.row[:0], strconv.Itoa(ru.Line), ru.Name)
+	if ru.Email != nil {
+		r.row = append(r.row, *ru.Email)
+	}
+	if ru.Phone != nil {
+		r.row = append(r.row, *ru.Phone)
+	}
+	r.cw.Write(r.row)
+}
+
+func (r *csvResults) end(browsers int) error {
+	r.cw.Flush()
+	if err := r.cw.Error(); err != nil {
+		return err
+	}
+	return r.w.Flush()
+}
+
+// templateResults executes the template for every user, each followed
+// by a newline. The dropped fields are empty.
+type templateResults struct {
+	w   *bufio.Writer
+	o   *output
+	err error
+}
+
+func newTemplateResults(w *bufio.Writer, o *output) resultWriter {
+	return &templateResults{w: w, o: o}
+}
+
+func (r *templateResults) user(line int, u *user) {
+	if r.err != nil {
+		return
+	}
+	ru := r.o.resultUser(line, u)
+	data := struct {
+		Line               int
+		Name, Email, Phone string
+	}{Line: ru.Line, Name: ru.Name}
+	if ru.Email != nil {
+		data.Email = *ru.Email
+	}
+	if ru.Phone != nil {
+		data.Phone = *ru.Phone
+	}
+	if r.err = r.o.template.Execute(r.w, data); r.err == nil {
+		r.w.WriteByte('\n')
+	}
+}
+
+func (r *templateResults) end(browsers int) error {
+	if r.err != nil {
+		return r.err
+	}
+	return r.w.Flush()
+}
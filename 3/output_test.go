@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestPolicies(t *testing.T) {
+	cases := []struct {
+		policy   policy
+		field    field
+		value    string
+		key      string
+		expected string
+	}{
+		{policyPlain, fieldEmail, "ann@mail.com", "", "ann@mail.com"},
+		{policyAt, fieldEmail, "ann@mail.com", "", "ann [at] mail.com"},
+		{policyMask, fieldEmail, "ann@mail.com", "", "a***@mail.com"},
+		{policyMask, fieldEmail, "ann", "", "a***"},
+		{policyMask, fieldEmail, "@mail.com", "", "***@mail.com"},
+		{policyMask, fieldEmail, "", "", "***"},
+		{policyMask, fieldPhone, "176-88-49", "", "***-**-49"},
+		{policyMask, fieldPhone, "7", "", "7"},
+		{policyHash, fieldEmail, "ann@mail.com", "secret", "09990a16acdeeed0"},
+		{policyHash, fieldEmail, "ann@mail.com", "other", "cc093dfeba68dcf1"},
+		{policyDrop, fieldPhone, "176-88-49", "", ""},
+	}
+	for _, c := range cases {
+		if got := string(c.policy.append(nil, c.field, []byte(c.value), c.key)); got != c.expected {
+			t.Errorf("results not match for %d of %q\nGot:\n%v\nExpected:\n%v", c.policy, c.value, got, c.expected)
+		}
+	}
+}
+
+// runOutput runs the query over the users as o says, checking that the
+// parallel search writes the same
+func runOutput(t *testing.T, q *Query, o *output) string {
+	t.Helper()
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	out := &bytes.Buffer{}
+	if err := q.run(bytes.NewReader(data), o, out); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	parallel := &bytes.Buffer{}
+	if err := q.runParallel(bytes.NewReader(data), int64(len(data)), o, parallel, 4); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if parallel.String() != out.String() {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", parallel, out)
+	}
+	return out.String()
+}
+
+func mustOutput(t *testing.T, format, tmpl, email, phone string) *output {
+	t.Helper()
+	o, err := newOutput(format, tmpl, email, phone, "secret")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	return o
+}
+
+func TestOutputText(t *testing.T) {
+	if got, expected := runOutput(t, androidMSIE, mustOutput(t, "text", "", "at", "drop")), slowReport(); got != expected {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", got, expected)
+	}
+
+	got := runOutput(t, androidMSIE, mustOutput(t, "text", "", "drop", "mask"))
+	if !strings.HasPrefix(got, "found users:\n[1] Susan Ellis ***-**-57\n") || strings.Contains(got, "@") {
+		t.Errorf("wrong report:\n%s", got)
+	}
+}
+
+func TestOutputJSON(t *testing.T) {
+	got := runOutput(t, androidMSIE, mustOutput(t, "json", "", "plain", "plain"))
+	report := struct {
+		Users []struct {
+			Line  int    `json:"line"`
+			Name  string `json:"name"`
+			Email string `json:"email"`
+			Phone string `json:"phone"`
+		} `json:"users"`
+		UniqueBrowsers int `json:"unique_browsers"`
+	}{}
+	if err := json.Unmarshal([]byte(got), &report); err != nil {
+		t.Fatalf("unexpected error: %s\n%s", err, got)
+	}
+
+	// the same users as the text report, with their phones
+	text := &bytes.Buffer{}
+	for _, u := range report.Users {
+		text.WriteString(string(appendIndex(nil, u.Line)) + u.Name + " <" + strings.ReplaceAll(u.Email, "@", " [at] ") + ">\n")
+		if u.Phone == "" {
+			t.Errorf("no phone for %v", u)
+		}
+	}
+	expected := slowReport()
+	if got := "found users:\n" + text.String() + "\nTotal unique browsers " + strconv.Itoa(report.UniqueBrowsers) + "\n"; got != expected {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", got, expected)
+	}
+
+	// dropped fields are left out
+	got = runOutput(t, MustParseQuery(`name = "nobody"`), mustOutput(t, "json", "", "drop", "drop"))
+	if got != "{\"users\":[\n],\"unique_browsers\":0}\n" {
+		t.Errorf("wrong report:\n%s", got)
+	}
+	got = runOutput(t, androidMSIE, mustOutput(t, "json", "", "drop", "drop"))
+	if strings.Contains(got, `"email"`) || strings.Contains(got, `"phone"`) {
+		t.Errorf("fields not dropped:\n%s", got)
+	}
+}
+
+func TestOutputCSV(t *testing.T) {
+	got := runOutput(t, androidMSIE, mustOutput(t, "csv", "", "hash", "drop"))
+	records, err := csv.NewReader(strings.NewReader(got)).ReadAll()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if strings.Join(records[0], ",") != "line,name,email" {
+		t.Errorf("wrong header: %v", records[0])
+	}
+	if expected := strings.Count(slowReport(), " [at] "); len(records)-1 != expected {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", len(records)-1, expected)
+	}
+	for _, r := range records[1:] {
+		if len(r[2]) != 16 || strings.Contains(r[2], "@") {
+			t.Errorf("email not hashed: %v", r)
+		}
+	}
+}
+
+func TestOutputTemplate(t *testing.T) {
+	o := mustOutput(t, "text", "{{.Line}}:{{.Name}}:{{.Email}}", "mask", "drop")
+	if o.format != outputTemplate {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", o.format, outputTemplate)
+	}
+	got := runOutput(t, androidMSIE, o)
+	if !strings.HasPrefix(got, "1:Susan Ellis:e***@Topiczoom.info\n5:Melissa Price:") {
+		t.Errorf("wrong report:\n%s", got)
+	}
+
+	o = mustOutput(t, "template", "{{.Missing}}", "at", "drop")
+	err := androidMSIE.run(strings.NewReader(`{"browsers":["Android MSIE"]}`), o, ioutil.Discard)
+	if err == nil {
+		t.Errorf("expected error for %s", "{{.Missing}}")
+	}
+}
+
+// the index answers unless the phones are written
+func TestOutputIndexed(t *testing.T) {
+	path := copyUsers(t, "")
+	ix, err := BuildIndex(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	o := mustOutput(t, "json", "", "mask", "drop")
+	out := &bytes.Buffer{}
+	if err := androidMSIE.runIndexed(ix, o, out); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if expected := runOutput(t, androidMSIE, o); out.String() != expected {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", out, expected)
+	}
+
+	o = mustOutput(t, "json", "", "mask", "mask")
+	if err := androidMSIE.runIndexed(ix, o, out); err != ErrNotIndexed {
+		t.Errorf("wrong error\nGot: %v\nExpected: %v", err, ErrNotIndexed)
+	}
+	out.Reset()
+	if err := search(out, options{path: path, query: androidMSIE, output: o}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if expected := runOutput(t, androidMSIE, o); out.String() != expected {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", out, expected)
+	}
+}
+
+// a file searched in parallel is written as o says too
+func TestSearchParallelOutput(t *testing.T) {
+	o := mustOutput(t, "json", "", "drop", "mask")
+	out := &bytes.Buffer{}
+	if err := search(out, options{path: filePath, query: androidMSIE, shards: 4, output: o}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if expected := runOutput(t, androidMSIE, o); out.String() != expected {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", out, expected)
+	}
+	if strings.Contains(out.String(), "[at]") {
+		t.Errorf("emails written:\n%s", out)
+	}
+}
+
+func TestParseArgsOutput(t *testing.T) {
+	t.Setenv(hashKeyEnv, "secret")
+	opts, err := parseArgs([]string{"-o", "csv", "-email", "hash", "-phone", "mask"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if o := opts.output; o.format != outputCSV || o.email != policyHash || o.phone != policyMask || o.key != "secret" {
+		t.Errorf("wrong args: %+v", o)
+	}
+
+	t.Setenv(hashKeyEnv, "")
+	opts, err = parseArgs(nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if *opts.output != *textOutput {
+		t.Errorf("wrong args: %+v", opts.output)
+	}
+	// hashes without a key could be reversed from a list of emails
+	for _, args := range [][]string{{"-email", "hash"}, {"-phone", "hash"}} {
+		if _, err := parseArgs(args); err == nil || !strings.Contains(err.Error(), hashKeyEnv) {
+			t.Errorf("wrong error for %q\nGot: %v\nExpected: ... %s", args, err, hashKeyEnv)
+		}
+	}
+	for _, args := range [][]string{
+		{"-o", "xml"}, {"-o", "template"}, {"-f", "{{"}, {"-email", "hide"}, {"-phone", ""},
+	} {
+		if _, err := parseArgs(args); err == nil {
+			t.Errorf("expected error for %q", args)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// RunParallel writes the report of Run for the size bytes of in. The
+// input is cut into shards byte ranges on line boundaries which are
+// searched concurrently, then the results are merged in order, so the
+// report is exactly the one of Run. Compressed input cannot be cut and
+// is searched sequentially.
+func (q *Query) RunParallel(in io.ReaderAt, size int64, out io.Writer, shards int) error {
+	return q.runParallel(in, size, textOutput, out, shards)
+}
+
+// runParallel is RunParallel writing the users found as o says.
+func (q *Query) runParallel(in io.ReaderAt, size int64, o *output, out io.Writer, shards int) error {
+	magic := make([]byte, 2)
+	if n, _ := in.ReadAt(magic, 0); n == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		return q.run(io.NewSectionReader(in, 0, size), o, out)
+	}
+	if shards < 1 {
+		shards = 1
+	}
+
+	results := make([]shard, shards)
+	wg := &sync.WaitGroup{}
+	for i := range results {
+		s := &results[i]
+		s.start = size * int64(i) / int64(shards)
+		s.end = size * int64(i+1) / int64(shards)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.search(q, o.fields(), in, size)
+		}()
+	}
+	wg.Wait()
+
+	rw := o.writer(out)
+	seen := map[string]struct{}{}
+	u := &user{}
+	base := 0
+	for i := range results {
+		s := &results[i]
+		if s.err != nil {
+			if s.errLine < 0 {
+				return s.err
+			}
+			return fmt.Errorf("line %d: %w", base+s.errLine+1, s.err)
+		}
+		prev := 0
+		for _, m := range s.matches {
+			u.name = s.found[prev:m.name]
+			u.email = s.found[m.name:m.email]
+			u.phone = s.found[m.email:m.phone]
+			rw.user(base+m.line, u)
+			prev = m.phone
+		}
+		base += s.lines
+		for browser := range s.seen {
+			seen[browser] = struct{}{}
+		}
+	}
+	return rw.end(len(seen))
+}
+
+// shard is the part of a parallel search over the lines starting
+// in [start, end).
+type shard struct {
+	start, end int64
+
+	lines   int
+	found   []byte // the names, emails and phones of the found users
+	matches []shardMatch
+	seen    map[string]struct{}
+	err     error
+	errLine int // the line of err in the shard, -1 if it is not about a line
+}
+
+// shardMatch is a found user: its line in the shard and the ends of
+// its fields in found.
+type shardMatch struct {
+	line               int
+	name, email, phone int
+}
+
+func (s *shard) search(q *Query, fields []field, in io.ReaderAt, size int64) {
+	s.errLine = -1
+	start := s.start
+	if start > 0 {
+		// the line going on at start belongs to the previous shard
+		if start, s.err = nextLine(in, start-1, size); s.err != nil {
+			return
+		}
+	}
+	if start >= s.end {
+		return
+	}
+
+	var offset, lineStart int64 = start, 0
+	scanner := bufio.NewScanner(io.NewSectionReader(in, start, size-start))
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+	scanner.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		advance, token, err := bufio.ScanLines(data, atEOF)
+		if token != nil {
+			lineStart = offset
+			offset += int64(advance)
+		}
+		return advance, token, err
+	})
+
+	p := newPass(q, fields...)
+	for ; scanner.Scan() && lineStart < s.end; s.lines++ {
+		found, err := p.line(scanner.Bytes())
+		if err != nil {
+			s.err, s.errLine = err, s.lines
+			return
+		}
+		if found {
+			m := shardMatch{line: s.lines}
+			s.found = append(s.found, p.u.name...)
+			m.name = len(s.found)
+			s.found = append(s.found, p.u.email...)
+			m.email = len(s.found)
+			s.found = append(s.found, p.u.phone...)
+			m.phone = len(s.found)
+			s.matches = append(s.matches, m)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		s.err = err
+	}
+	s.seen = p.seen
+}
+
+// nextLine returns the offset of the line after the one going on at off.
+func nextLine(in io.ReaderAt, off, size int64) (int64, error) {
+	buf := make([]byte, 4096)
+	for off < size {
+		n, err := in.ReadAt(buf, off)
+		for i, c := range buf[:n] {
+			if c == '\n' {
+				return off + int64(i) + 1, nil
+			}
+		}
+		off += int64(n)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	return size, nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func runSequential(t *testing.T, q *Query, data []byte) (string, error) {
+	t.Helper()
+	out := &bytes.Buffer{}
+	err := q.Run(bytes.NewReader(data), out)
+	return out.String(), err
+}
+
+func TestRunParallel(t *testing.T) {
+	users, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	lines := strings.Split(string(users), "\n")
+	inputs := map[string][]byte{
+		"users":            users,
+		"trailing newline": append(append([]byte{}, users...), '\n'),
+		"blank lines":      []byte(strings.Join(lines[:50], "\n\n\n")),
+		"crlf":             []byte(strings.Join(lines[:50], "\r\n")),
+		"few lines":        []byte(strings.Join(lines[:3], "\n")),
+		"empty":            nil,
+	}
+	queries := []*Query{
+		androidMSIE,
+		MustParseQuery(`country matches "^[A-K]" or browsers contains "Firefox"`),
+	}
+
+	for name, data := range inputs {
+		for _, q := range queries {
+			expected, err := runSequential(t, q, data)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			for _, shards := range []int{0, 1, 2, 3, 7, 16, 100} {
+				out := &bytes.Buffer{}
+				err := q.RunParallel(bytes.NewReader(data), int64(len(data)), out, shards)
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				if out.String() != expected {
+					t.Errorf("results not match for %s, %s, %d shards\nGot:\n%v\nExpected:\n%v",
+						name, q, shards, out, expected)
+				}
+			}
+		}
+	}
+}
+
+func TestRunParallelGzip(t *testing.T) {
+	users, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	compressed := &bytes.Buffer{}
+	zw := gzip.NewWriter(compressed)
+	zw.Write(users)
+	zw.Close()
+
+	out := &bytes.Buffer{}
+	err = androidMSIE.RunParallel(bytes.NewReader(compressed.Bytes()), int64(compressed.Len()), out, 4)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if expected := slowReport(); out.String() != expected {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", out, expected)
+	}
+}
+
+// the bad line is reported with the same number as by Run
+func TestRunParallelError(t *testing.T) {
+	lines := make([]string, 100)
+	for i := range lines {
+		lines[i] = fmt.Sprintf(`{"name":"user %d"}`, i)
+	}
+	lines[77] = `{"name":`
+	data := []byte(strings.Join(lines, "\n"))
+
+	_, expected := runSequential(t, androidMSIE, data)
+	err := androidMSIE.RunParallel(bytes.NewReader(data), int64(len(data)), ioutil.Discard, 8)
+	if err == nil || expected == nil || err.Error() != expected.Error() {
+		t.Errorf("wrong error\nGot: %v\nExpected: %v", err, expected)
+	}
+}
+
+func TestSearchFileParallel(t *testing.T) {
+	out := &bytes.Buffer{}
+	if err := search(out, options{path: filePath, query: androidMSIE, shards: 4}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if expected := slowReport(); out.String() != expected {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", out, expected)
+	}
+}
+
+// go test -bench Parallel -cpu 1,2,4,8
+func BenchmarkParallel(b *testing.B) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		b.Fatalf("unexpected error: %s", err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		b.Fatalf("unexpected error: %s", err)
+	}
+
+	for _, shards := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("shards-%d", shards), func(b *testing.B) {
+			b.SetBytes(info.Size())
+			for i := 0; i < b.N; i++ {
+				if err := androidMSIE.RunParallel(file, info.Size(), ioutil.Discard, shards); err != nil {
+					b.Fatalf("unexpected error: %s", err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// A query selects users by their fields:
+//
+//	query     = or
+//	or        = and { "or" and }
+//	and       = not { "and" not }
+//	not       = "not" not | "(" or ")" | predicate
+//	predicate = field ( "=" | "contains" | "matches" ) string
+//	field     = "browsers" | "company" | "country" | "email" | "job" | "name" | "phone"
+//
+// Strings are double-quoted Go strings. "=" is equality, "contains"
+// a substring and "matches" a regular expression. A browsers predicate
+// holds if it holds for any of the browsers. Keywords are case-insensitive:
+//
+//	browsers contains "Android" and not (country = "Kenya" or job matches "^Web")
+type Query struct {
+	text  string
+	preds []predicate
+	root  *node
+}
+
+type field int
+
+const (
+	fieldBrowsers field = iota
+	fieldCompany
+	fieldCountry
+	fieldEmail
+	fieldJob
+	fieldName
+	fieldPhone
+)
+
+var fieldNames = map[string]field{
+	"browsers": fieldBrowsers,
+	"company":  fieldCompany,
+	"country":  fieldCountry,
+	"email":    fieldEmail,
+	"job":      fieldJob,
+	"name":     fieldName,
+	"phone":    fieldPhone,
+}
+
+type matchKind int
+
+const (
+	matchEqual matchKind = iota
+	matchContains
+	matchRegexp
+)
+
+type predicate struct {
+	field field
+	kind  matchKind
+	value []byte
+	re    *regexp.Regexp
+}
+
+func (p *predicate) match(b []byte) bool {
+	switch p.kind {
+	case matchEqual:
+		return bytes.Equal(b, p.value)
+	case matchContains:
+		return bytes.Contains(b, p.value)
+	}
+	return p.re.Match(b)
+}
+
+type nodeKind int
+
+const (
+	nodeAnd nodeKind = iota
+	nodeOr
+	nodeNot
+	nodePred
+)
+
+// node is an expression of the query. The predicates are evaluated
+// beforehand, a nodePred only refers to the result by index.
+type node struct {
+	kind        nodeKind
+	left, right *node
+	pred        int
+}
+
+func (n *node) eval(results []bool) bool {
+	switch n.kind {
+	case nodeAnd:
+		return n.left.eval(results) && n.right.eval(results)
+	case nodeOr:
+		return n.left.eval(results) || n.right.eval(results)
+	case nodeNot:
+		return !n.left.eval(results)
+	}
+	return results[n.pred]
+}
+
+// ParseQuery compiles a query.
+func ParseQuery(text string) (*Query, error) {
+	p := &parser{text: text}
+	p.next()
+	q := &Query{text: text}
+	root, err := p.or(q)
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokEOF {
+		return nil, p.errorf("unexpected %s", p.tok)
+	}
+	q.root = root
+	return q, nil
+}
+
+// MustParseQuery is ParseQuery panicking on error.
+func MustParseQuery(text string) *Query {
+	q, err := ParseQuery(text)
+	if err != nil {
+		panic(err)
+	}
+	return q
+}
+
+func (q *Query) String() string {
+	return q.text
+}
+
+// fields returns the fields read by the predicates of q.
+func (q *Query) fields() []field {
+	var fields []field
+	for _, p := range q.preds {
+		if !hasField(fields, p.field) {
+			fields = append(fields, p.field)
+		}
+	}
+	return fields
+}
+
+// match reports whether u is selected. results has room for a result
+// per predicate; seen is called with every browser matching a browsers
+// predicate, whatever the result.
+func (q *Query) match(u *user, results []bool, seen func([]byte)) bool {
+	for i := range q.preds {
+		p := &q.preds[i]
+		if p.field != fieldBrowsers {
+			results[i] = p.match(*u.field(p.field))
+		} else {
+			results[i] = false
+		}
+	}
+	for _, browser := range u.browsers {
+		matched := false
+		for i := range q.preds {
+			p := &q.preds[i]
+			if p.field == fieldBrowsers && p.match(browser) {
+				results[i] = true
+				matched = true
+			}
+		}
+		if matched {
+			seen(browser)
+		}
+	}
+	return q.root.eval(results)
+}
+
+type tokKind int
+
+const (
+	tokEOF tokKind = iota
+	tokWord
+	tokString
+	tokEqual
+	tokLParen
+	tokRParen
+	tokInvalid
+)
+
+type token struct {
+	kind tokKind
+	text string
+	pos  int
+}
+
+func (t token) String() string {
+	if t.kind == tokEOF {
+		return "end of query"
+	}
+	return strconv.Quote(t.text)
+}
+
+type parser struct {
+	text string
+	pos  int
+	tok  token
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("query: position %d: %s", p.tok.pos, fmt.Sprintf(format, args...))
+}
+
+// next reads the next token into p.tok.
+func (p *parser) next() {
+	for p.pos < len(p.text) && strings.IndexByte(" \t\r\n", p.text[p.pos]) >= 0 {
+		p.pos++
+	}
+	start := p.pos
+	if p.pos == len(p.text) {
+		p.tok = token{kind: tokEOF, pos: start}
+		return
+	}
+	kind := tokInvalid
+	switch c := p.text[p.pos]; {
+	case c == '(':
+		kind = tokLParen
+		p.pos++
+	case c == ')':
+		kind = tokRParen
+		p.pos++
+	case c == '=':
+		kind = tokEqual
+		p.pos++
+	case c == '"':
+		kind = tokString
+		for p.pos++; p.pos < len(p.text) && p.text[p.pos] != '"'; p.pos++ {
+			if p.text[p.pos] == '\\' {
+				p.pos++
+			}
+		}
+		if p.pos < len(p.text) {
+			p.pos++
+		} else {
+			kind = tokInvalid
+		}
+	case c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z':
+		kind = tokWord
+		for p.pos < len(p.text) && (p.text[p.pos] == '_' ||
+			'a' <= p.text[p.pos] && p.text[p.pos] <= 'z' ||
+			'A' <= p.text[p.pos] && p.text[p.pos] <= 'Z') {
+			p.pos++
+		}
+	default:
+		p.pos++
+	}
+	p.tok = token{kind: kind, text: p.text[start:p.pos], pos: start}
+}
+
+// keyword reports whether the token is the word kw.
+func (p *parser) keyword(kw string) bool {
+	return p.tok.kind == tokWord && strings.EqualFold(p.tok.text, kw)
+}
+
+func (p *parser) or(q *Query) (*node, error) {
+	left, err := p.and(q)
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("or") {
+		p.next()
+		right, err := p.and(q)
+		if err != nil {
+			return nil, err
+		}
+		left = &node{kind: nodeOr, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) and(q *Query) (*node, error) {
+	left, err := p.not(q)
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("and") {
+		p.next()
+		right, err := p.not(q)
+		if err != nil {
+			return nil, err
+		}
+		left = &node{kind: nodeAnd, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) not(q *Query) (*node, error) {
+	switch {
+	case p.keyword("not"):
+		p.next()
+		n, err := p.not(q)
+		if err != nil {
+			return nil, err
+		}
+		return &node{kind: nodeNot, left: n}, nil
+	case p.tok.kind == tokLParen:
+		p.next()
+		n, err := p.or(q)
+		if err != nil {
+			return nil, err
+		}
+		if p.tok.kind != tokRParen {
+			return nil, p.errorf("expected ), got %s", p.tok)
+		}
+		p.next()
+		return n, nil
+	}
+	return p.predicate(q)
+}
+
+func (p *parser) predicate(q *Query) (*node, error) {
+	f, ok := fieldNames[strings.ToLower(p.tok.text)]
+	if p.tok.kind != tokWord || !ok {
+		return nil, p.errorf("expected field, got %s", p.tok)
+	}
+	p.next()
+
+	var kind matchKind
+	switch {
+	case p.tok.kind == tokEqual:
+		kind = matchEqual
+	case p.keyword("contains"):
+		kind = matchContains
+	case p.keyword("matches"):
+		kind = matchRegexp
+	default:
+		return nil, p.errorf("expected =, contains or matches, got %s", p.tok)
+	}
+	p.next()
+
+	if p.tok.kind != tokString {
+		return nil, p.errorf("expected string, got %s", p.tok)
+	}
+	value, err := strconv.Unquote(p.tok.text)
+	if err != nil {
+		return nil, p.errorf("bad string %s", p.tok)
+	}
+	pred := predicate{field: f, kind: kind, value: []byte(value)}
+	if kind == matchRegexp {
+		if pred.re, err = regexp.Compile(value); err != nil {
+			return nil, p.errorf("%s", err)
+		}
+	}
+	p.next()
+
+	q.preds = append(q.preds, pred)
+	return &node{kind: nodePred, pred: len(q.preds) - 1}, nil
+}
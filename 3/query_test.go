@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+type jsonUser struct {
+	Browsers []string `json:"browsers"`
+	Company  string   `json:"company"`
+	Country  string   `json:"country"`
+	Email    string   `json:"email"`
+	Job      string   `json:"job"`
+	Name     string   `json:"name"`
+	Phone    string   `json:"phone"`
+}
+
+// expectedReport builds the report with encoding/json, selecting users
+// by match and counting the browsers accepted by seen
+func expectedReport(t *testing.T, match func(u jsonUser) bool, seen func(browser string) bool) string {
+	file, err := os.Open(filePath)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer file.Close()
+
+	report := "found users:\n"
+	browsers := map[string]bool{}
+	scanner := bufio.NewScanner(file)
+	for i := 0; scanner.Scan(); i++ {
+		u := jsonUser{}
+		if err := json.Unmarshal(scanner.Bytes(), &u); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		for _, b := range u.Browsers {
+			if seen(b) {
+				browsers[b] = true
+			}
+		}
+		if match(u) {
+			report += fmt.Sprintf("[%d] %s <%s>\n", i, u.Name, strings.ReplaceAll(u.Email, "@", " [at] "))
+		}
+	}
+	return report + fmt.Sprintf("\nTotal unique browsers %d\n", len(browsers))
+}
+
+func anyBrowser(u jsonUser, f func(string) bool) bool {
+	for _, b := range u.Browsers {
+		if f(b) {
+			return true
+		}
+	}
+	return false
+}
+
+func runQuery(t *testing.T, text string) string {
+	q, err := ParseQuery(text)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	file, err := os.Open(filePath)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer file.Close()
+	out := &bytes.Buffer{}
+	if err := q.Run(file, out); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	return out.String()
+}
+
+func TestQueryRun(t *testing.T) {
+	webJob := regexp.MustCompile("^Web")
+	never := func(string) bool { return false }
+	chrome := func(b string) bool { return strings.Contains(b, "Chrome") }
+
+	for _, c := range []struct {
+		query string
+		match func(u jsonUser) bool
+		seen  func(browser string) bool
+	}{
+		{
+			`country = "Kenya"`,
+			func(u jsonUser) bool { return u.Country == "Kenya" },
+			never,
+		},
+		{
+			`NOT browsers contains "Chrome" or job matches "^Web"`,
+			func(u jsonUser) bool { return !anyBrowser(u, chrome) || webJob.MatchString(u.Job) },
+			chrome,
+		},
+		{
+			`company contains "a" and not (country = "Kenya" or email matches "\\.edu$")`,
+			func(u jsonUser) bool {
+				return strings.Contains(u.Company, "a") &&
+					!(u.Country == "Kenya" || strings.HasSuffix(u.Email, ".edu"))
+			},
+			never,
+		},
+		{
+			`browsers matches "^Opera" or browsers contains "iPad" and name contains "Susan"`,
+			func(u jsonUser) bool {
+				return anyBrowser(u, func(b string) bool { return strings.HasPrefix(b, "Opera") }) ||
+					anyBrowser(u, func(b string) bool { return strings.Contains(b, "iPad") }) &&
+						strings.Contains(u.Name, "Susan")
+			},
+			func(b string) bool { return strings.HasPrefix(b, "Opera") || strings.Contains(b, "iPad") },
+		},
+	} {
+		result := runQuery(t, c.query)
+		expected := expectedReport(t, c.match, c.seen)
+		if result != expected {
+			t.Errorf("results not match for %s\nGot:\n%v\nExpected:\n%v", c.query, result, expected)
+		}
+	}
+}
+
+func TestQueryRunSlowSearch(t *testing.T) {
+	expected := &bytes.Buffer{}
+	SlowSearch(expected)
+	result := runQuery(t, `browsers contains "Android" AND browsers contains "MSIE"`)
+	if result != expected.String() {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", result, expected)
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	for _, c := range []struct {
+		query, err string
+	}{
+		{``, `position 0: expected field, got end of query`},
+		{`age = "10"`, `position 0: expected field, got "age"`},
+		{`job is "x"`, `position 4: expected =, contains or matches, got "is"`},
+		{`job = x`, `position 6: expected string, got "x"`},
+		{`job = "x`, `position 6: expected string, got "\"x"`},
+		{`(job = "x"`, `position 10: expected ), got end of query`},
+		{`job = "x" job = "y"`, `position 10: unexpected "job"`},
+		{`job matches "("`, "position 12: error parsing regexp: missing closing ): `(`"},
+	} {
+		_, err := ParseQuery(c.query)
+		if err == nil || err.Error() != "query: "+c.err {
+			t.Errorf("wrong error for %s\nGot: %v\nExpected: query: %s", c.query, err, c.err)
+		}
+	}
+}
+
+func TestQueryRunBadLine(t *testing.T) {
+	in := strings.NewReader(`{"name":"a","email":"a@b"}` + "\n\n" + `{"name":"b",}`)
+	err := androidMSIE.Run(in, &bytes.Buffer{})
+	if err == nil || !strings.HasPrefix(err.Error(), "line 3: ") {
+		t.Errorf("wrong error\nGot: %v\nExpected: line 3: ...", err)
+	}
+}
+
+func TestUserUnmarshal(t *testing.T) {
+	u := &user{}
+	line := ` { "name" : "A \"B\"", "age": 30, "tags": {"x": [1, "]"]},
+		"browsers": ["x", "yA"], "email": "a@b", "ok": true } `
+	if err := u.unmarshal([]byte(line)); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if string(u.name) != `A "B"` || string(u.email) != "a@b" ||
+		len(u.browsers) != 2 || string(u.browsers[0]) != "x" || string(u.browsers[1]) != "yA" {
+		t.Errorf("wrong user: name %q, email %q, browsers %q", u.name, u.email, u.browsers)
+	}
+
+	// the fields of the previous line are reset
+	if err := u.unmarshal([]byte(`{"browsers":[]}`)); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if u.name != nil || len(u.browsers) != 0 {
+		t.Errorf("fields not reset: name %q, browsers %q", u.name, u.browsers)
+	}
+
+	for _, bad := range []string{``, `[]`, `{"name"}`, `{"name":"a"`, `{"name":"a"} x`, `{"browsers":"a"}`} {
+		if err := u.unmarshal([]byte(bad)); err == nil {
+			t.Errorf("expected error for %s", bad)
+		}
+	}
+}
+
+func TestUserUnmarshalAllocs(t *testing.T) {
+	line := []byte(`{"browsers":["a","b","c"],"company":"c","country":"k","email":"a@b","job":"j","name":"n","phone":"1"}`)
+	u := &user{}
+	u.unmarshal(line)
+	allocs := testing.AllocsPerRun(100, func() {
+		u.unmarshal(line)
+	})
+	if allocs != 0 {
+		t.Errorf("unmarshal allocates\nGot: %v\nExpected: 0", allocs)
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// browserReport is what the browsers of the users tell.
+type browserReport struct {
+	// Agents counts every browser of every user by what its user-agent says.
+	Agents []agentCount `json:"agents"`
+	// TopByCountry is the browser families used by most users of every country.
+	TopByCountry []countryTop `json:"top_by_country"`
+	AndroidMSIE  cooccurrence `json:"android_msie"`
+}
+
+type agentCount struct {
+	agent
+	Count int `json:"count"`
+}
+
+type familyCount struct {
+	Family string `json:"family"`
+	Users  int    `json:"users"`
+}
+
+type countryTop struct {
+	Country  string        `json:"country"`
+	Browsers []familyCount `json:"browsers"`
+}
+
+// cooccurrence counts the users with an Android browser, an MSIE one
+// and both, the way SlowSearch finds them.
+type cooccurrence struct {
+	Users   int `json:"users"`
+	Android int `json:"android"`
+	MSIE    int `json:"msie"`
+	Both    int `json:"both"`
+}
+
+// buildReport reads the users of in and keeps the top families
+// of every country.
+func buildReport(in io.Reader, top int) (*browserReport, error) {
+	in, err := decompress(in)
+	if err != nil {
+		return nil, err
+	}
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+
+	report := &browserReport{}
+	parsed := map[string]agent{}
+	agents := map[agent]int{}
+	countries := map[string]map[string]int{}
+	u := newUser(fieldBrowsers, fieldCountry)
+	for i := 0; scanner.Scan(); i++ {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		if err := u.unmarshal(line); err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		report.AndroidMSIE.Users++
+
+		families := countries[string(u.country)]
+		if families == nil {
+			families = map[string]int{}
+			countries[string(u.country)] = families
+		}
+		// a user with two browsers of a family counts once
+		counted := map[string]bool{}
+		android, msie := false, false
+		for _, browser := range u.browsers {
+			a, ok := parsed[string(browser)]
+			if !ok {
+				a = parseUserAgent(string(browser))
+				parsed[string(browser)] = a
+			}
+			agents[a]++
+			if !counted[a.Family] {
+				counted[a.Family] = true
+				families[a.Family]++
+			}
+			android = android || strings.Contains(string(browser), "Android")
+			msie = msie || strings.Contains(string(browser), "MSIE")
+		}
+		if android {
+			report.AndroidMSIE.Android++
+		}
+		if msie {
+			report.AndroidMSIE.MSIE++
+		}
+		if android && msie {
+			report.AndroidMSIE.Both++
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for a, n := range agents {
+		report.Agents = append(report.Agents, agentCount{agent: a, Count: n})
+	}
+	sort.Slice(report.Agents, func(i, j int) bool {
+		a, b := report.Agents[i], report.Agents[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.agent.less(b.agent)
+	})
+
+	for country, families := range countries {
+		ct := countryTop{Country: country}
+		for family, n := range families {
+			ct.Browsers = append(ct.Browsers, familyCount{Family: family, Users: n})
+		}
+		sort.Slice(ct.Browsers, func(i, j int) bool {
+			a, b := ct.Browsers[i], ct.Browsers[j]
+			if a.Users != b.Users {
+				return a.Users > b.Users
+			}
+			return a.Family < b.Family
+		})
+		if top > 0 && len(ct.Browsers) > top {
+			ct.Browsers = ct.Browsers[:top]
+		}
+		report.TopByCountry = append(report.TopByCountry, ct)
+	}
+	sort.Slice(report.TopByCountry, func(i, j int) bool {
+		return report.TopByCountry[i].Country < report.TopByCountry[j].Country
+	})
+	return report, nil
+}
+
+func (a agent) less(b agent) bool {
+	if a.Family != b.Family {
+		return a.Family < b.Family
+	}
+	if a.Version != b.Version {
+		va, _ := strconv.Atoi(a.Version)
+		vb, _ := strconv.Atoi(b.Version)
+		if va != vb {
+			return va < vb
+		}
+		return a.Version < b.Version
+	}
+	if a.OS != b.OS {
+		return a.OS < b.OS
+	}
+	return a.Device < b.Device
+}
+
+const (
+	reportText = "text"
+	reportCSV  = "csv"
+	reportJSON = "json"
+)
+
+type reportRenderer func(w io.Writer, report *browserReport) error
+
+var reportRenderers = map[string]reportRenderer{
+	reportText: renderReportText,
+	reportCSV:  renderReportCSV,
+	reportJSON: renderReportJSON,
+}
+
+func renderReportText(w io.Writer, report *browserReport) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "browsers:")
+	fmt.Fprintln(tw, "COUNT\tFAMILY\tVERSION\tOS\tDEVICE")
+	for _, a := range report.Agents {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\n", a.Count, a.Family, a.Version, a.OS, a.Device)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	bw.WriteString("\nbrowsers by country:\n")
+	for _, ct := range report.TopByCountry {
+		browsers := make([]string, len(ct.Browsers))
+		for i, b := range ct.Browsers {
+			browsers[i] = fmt.Sprintf("%s %d", b.Family, b.Users)
+		}
+		fmt.Fprintf(bw, "%s: %s\n", ct.Country, strings.Join(browsers, ", "))
+	}
+	c := report.AndroidMSIE
+	fmt.Fprintf(bw, "\nAndroid and MSIE:\nusers %d\nAndroid %d\nMSIE %d\nboth %d\n", c.Users, c.Android, c.MSIE, c.Both)
+	return bw.Flush()
+}
+
+// renderReportCSV writes all the tables as rows of a single one, the
+// table column telling which they come from.
+func renderReportCSV(w io.Writer, report *browserReport) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"table", "country", "family", "version", "os", "device", "count"})
+	for _, a := range report.Agents {
+		cw.Write([]string{"agents", "", a.Family, a.Version, a.OS, a.Device, strconv.Itoa(a.Count)})
+	}
+	for _, ct := range report.TopByCountry {
+		for _, b := range ct.Browsers {
+			cw.Write([]string{"top_by_country", ct.Country, b.Family, "", "", "", strconv.Itoa(b.Users)})
+		}
+	}
+	c := report.AndroidMSIE
+	for _, row := range []struct {
+		name  string
+		count int
+	}{{"users", c.Users}, {"Android", c.Android}, {"MSIE", c.MSIE}, {"both", c.Both}} {
+		cw.Write([]string{"android_msie", "", row.name, "", "", "", strconv.Itoa(row.count)})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func renderReportJSON(w io.Writer, report *browserReport) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func fileReport(t *testing.T, top int) *browserReport {
+	t.Helper()
+	file, err := os.Open(filePath)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer file.Close()
+	report, err := buildReport(file, top)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	return report
+}
+
+// the counts agree with the ones of encoding/json
+func TestBuildReport(t *testing.T) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer file.Close()
+
+	expected := cooccurrence{}
+	browsers := 0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		u := jsonUser{}
+		if err := json.Unmarshal(scanner.Bytes(), &u); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		android := anyBrowser(u, func(b string) bool { return strings.Contains(b, "Android") })
+		msie := anyBrowser(u, func(b string) bool { return strings.Contains(b, "MSIE") })
+		expected.Users++
+		if android {
+			expected.Android++
+		}
+		if msie {
+			expected.MSIE++
+		}
+		if android && msie {
+			expected.Both++
+		}
+		browsers += len(u.Browsers)
+	}
+
+	report := fileReport(t, 0)
+	if report.AndroidMSIE != expected {
+		t.Errorf("results not match\nGot:\n%+v\nExpected:\n%+v", report.AndroidMSIE, expected)
+	}
+	counted := 0
+	for i, a := range report.Agents {
+		counted += a.Count
+		if i > 0 && a.Count > report.Agents[i-1].Count {
+			t.Errorf("agents not sorted at %d: %+v", i, a)
+		}
+	}
+	if counted != browsers {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", counted, browsers)
+	}
+}
+
+func TestBuildReportTop(t *testing.T) {
+	all := fileReport(t, 0)
+	top := fileReport(t, 2)
+	if len(top.TopByCountry) != len(all.TopByCountry) {
+		t.Fatalf("results not match\nGot:\n%v\nExpected:\n%v", len(top.TopByCountry), len(all.TopByCountry))
+	}
+	for i, ct := range top.TopByCountry {
+		expected := all.TopByCountry[i].Browsers
+		if len(expected) > 2 {
+			expected = expected[:2]
+		}
+		if !reflect.DeepEqual(ct.Browsers, expected) {
+			t.Errorf("results not match for %s\nGot:\n%v\nExpected:\n%v", ct.Country, ct.Browsers, expected)
+		}
+	}
+}
+
+// a family is counted once per user
+func TestBuildReportFamilies(t *testing.T) {
+	in := `{"browsers":["Mozilla/5.0 (X11; Linux i686; rv:49.0) Gecko/20100101 Firefox/49.0","Mozilla/5.0 (Windows NT 6.1; rv:40.0) Gecko/20100101 Firefox/40.0"],"country":"Kenya"}
+{"browsers":["Mozilla/5.0 (Windows NT 6.1) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/41.0.2228.0 Safari/537.36"],"country":"Kenya"}
+
+{"browsers":["Mozilla/4.0 (compatible; MSIE 7.0; Windows NT 6.0)"],"country":"Chad"}
+`
+	report, err := buildReport(strings.NewReader(in), 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := []countryTop{
+		{Country: "Chad", Browsers: []familyCount{{"IE", 1}}},
+		{Country: "Kenya", Browsers: []familyCount{{"Chrome", 1}, {"Firefox", 1}}},
+	}
+	if !reflect.DeepEqual(report.TopByCountry, expected) {
+		t.Errorf("results not match\nGot:\n%+v\nExpected:\n%+v", report.TopByCountry, expected)
+	}
+	if c := (cooccurrence{Users: 3, MSIE: 1}); report.AndroidMSIE != c {
+		t.Errorf("results not match\nGot:\n%+v\nExpected:\n%+v", report.AndroidMSIE, c)
+	}
+}
+
+func TestBuildReportBadLine(t *testing.T) {
+	_, err := buildReport(strings.NewReader("{}\n{\"name\":"), 0)
+	if err == nil || !strings.HasPrefix(err.Error(), "line 2: ") {
+		t.Errorf("wrong error\nGot: %v\nExpected: line 2: ...", err)
+	}
+}
+
+func TestRenderReport(t *testing.T) {
+	report := fileReport(t, 3)
+
+	out := &bytes.Buffer{}
+	if err := renderReportText(out, report); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	text := out.String()
+	for _, s := range []string{"browsers:\nCOUNT  ", "\nbrowsers by country:\n", "\nAndroid and MSIE:\nusers 1000\n"} {
+		if !strings.Contains(text, s) {
+			t.Errorf("text report has no %q:\n%s", s, text)
+		}
+	}
+
+	out.Reset()
+	if err := renderReportJSON(out, report); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	decoded := &browserReport{}
+	if err := json.Unmarshal(out.Bytes(), decoded); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(decoded, report) {
+		t.Errorf("results not match\nGot:\n%+v\nExpected:\n%+v", decoded, report)
+	}
+
+	out.Reset()
+	if err := renderReportCSV(out, report); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	records, err := csv.NewReader(out).ReadAll()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	rows := map[string]int{}
+	for _, r := range records[1:] {
+		rows[r[0]]++
+		if r[0] == "android_msie" && r[2] == "both" && r[6] != strconv.Itoa(report.AndroidMSIE.Both) {
+			t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", r[6], report.AndroidMSIE.Both)
+		}
+	}
+	if rows["agents"] != len(report.Agents) || rows["android_msie"] != 4 {
+		t.Errorf("wrong csv rows: %v", rows)
+	}
+}
+
+func TestParseArgsReport(t *testing.T) {
+	opts, err := parseArgs([]string{"report", "-o", "csv", "-top", "5", "users.txt"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if opts.command != commandReport || opts.format != reportCSV || opts.top != 5 || opts.path != "users.txt" {
+		t.Errorf("wrong args: %+v", opts)
+	}
+	for _, args := range [][]string{{"report", "-o", "xml"}, {"report", "-q", "x"}, {"report", "a", "b"}} {
+		if _, err := parseArgs(args); err == nil {
+			t.Errorf("expected error for %q", args)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// maxLineSize is the longest line of users a search reads.
+const maxLineSize = 1 << 20
+
+// Run reads users from in, one JSON object per line, and writes the
+// report of SlowSearch for the users selected by q: their line numbers,
+// names and emails, then the number of unique browsers matching any
+// browsers predicate among all the users. in may be gzip-compressed.
+//
+// The users are read and reported one at a time, so memory does not
+// depend on the size of in, only on the number of unique browsers.
+func (q *Query) Run(in io.Reader, out io.Writer) error {
+	return q.run(in, textOutput, out)
+}
+
+// run is Run writing the users found as o says.
+func (q *Query) run(in io.Reader, o *output, out io.Writer) error {
+	in, err := decompress(in)
+	if err != nil {
+		return err
+	}
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+	rw := o.writer(out)
+	p := newPass(q, o.fields()...)
+
+	for i := 0; scanner.Scan(); i++ {
+		found, err := p.line(scanner.Bytes())
+		if err != nil {
+			return fmt.Errorf("line %d: %w", i+1, err)
+		}
+		if found {
+			rw.user(i, p.u)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return rw.end(len(p.seen))
+}
+
+// pass is the state of a query over a stream of lines.
+type pass struct {
+	q        *Query
+	u        *user
+	results  []bool
+	seen     map[string]struct{}
+	markSeen func([]byte)
+}
+
+// newPass returns a pass reading the fields of q and the given ones.
+func newPass(q *Query, fields ...field) *pass {
+	p := &pass{
+		q:       q,
+		u:       newUser(append(q.fields(), fields...)...),
+		results: make([]bool, len(q.preds)),
+		seen:    map[string]struct{}{},
+	}
+	p.markSeen = func(browser []byte) {
+		if _, ok := p.seen[string(browser)]; !ok {
+			p.seen[string(browser)] = struct{}{}
+		}
+	}
+	return p
+}
+
+// line reads the user on line, left in p.u, and reports whether it is
+// selected. Empty lines are skipped.
+func (p *pass) line(line []byte) (bool, error) {
+	if len(line) == 0 {
+		return false, nil
+	}
+	if err := p.u.unmarshal(line); err != nil {
+		return false, err
+	}
+	return p.q.match(p.u, p.results, p.markSeen), nil
+}
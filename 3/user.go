@@ -0,0 +1,85 @@
+package main
+
+import (
+	"hw3/jsonscan"
+)
+
+// user is a line of users.txt. The fields point into the line they were
+// read from and are valid until it is overwritten or the next one is read.
+type user struct {
+	browsers [][]byte
+	company  []byte
+	country  []byte
+	email    []byte
+	job      []byte
+	name     []byte
+	phone    []byte
+
+	fields  []field // the fields read, in the order of scanner
+	scanner *jsonscan.Scanner
+}
+
+// newUser returns a user reading only the given fields of the lines,
+// all of them if there are none. The other keys are skipped.
+func newUser(fields ...field) *user {
+	u := &user{}
+	var scanned []jsonscan.Field
+	for name, f := range fieldNames {
+		if len(fields) > 0 && !hasField(fields, f) {
+			continue
+		}
+		kind := jsonscan.String
+		if f == fieldBrowsers {
+			kind = jsonscan.Strings
+		}
+		scanned = append(scanned, jsonscan.Field{Name: name, Kind: kind})
+		u.fields = append(u.fields, f)
+	}
+	u.scanner = jsonscan.NewScanner(scanned...)
+	return u
+}
+
+func hasField(fields []field, f field) bool {
+	for _, g := range fields {
+		if g == f {
+			return true
+		}
+	}
+	return false
+}
+
+// unmarshal reads a JSON object into u without allocating. A zero user
+// reads all the fields.
+func (u *user) unmarshal(line []byte) error {
+	if u.scanner == nil {
+		*u = *newUser()
+	}
+	if err := u.scanner.Scan(line); err != nil {
+		return err
+	}
+	for i, f := range u.fields {
+		if f == fieldBrowsers {
+			u.browsers = u.scanner.Strings(i)
+		} else {
+			*u.field(f) = u.scanner.Bytes(i)
+		}
+	}
+	return nil
+}
+
+// field returns where the string field f is kept.
+func (u *user) field(f field) *[]byte {
+	switch f {
+	case fieldCompany:
+		return &u.company
+	case fieldCountry:
+		return &u.country
+	case fieldEmail:
+		return &u.email
+	case fieldJob:
+		return &u.job
+	case fieldName:
+		return &u.name
+	}
+	return &u.phone
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"strings"
+)
+
+// agent is what a user-agent string tells about the browser.
+type agent struct {
+	Family  string `json:"family"`
+	Version string `json:"version"`
+	OS      string `json:"os"`
+	Device  string `json:"device"`
+}
+
+// familyRule finds a browser family by token. The version is the major
+// number after versionToken, the token itself if it is empty.
+type familyRule struct {
+	token        string
+	family       string
+	versionToken string
+}
+
+// familyRules are tried in order: the first token found gives the
+// family, so browsers built on others come before them.
+var familyRules = []familyRule{
+	{"bot", "Bot", "-"},
+	{"Bot", "Bot", "-"},
+	{"spider", "Bot", "-"},
+	{"crawler", "Bot", "-"},
+	{"Slurp", "Bot", "-"},
+	{"Mediapartners-Google", "Bot", "-"},
+	{"Edge/", "Edge", ""},
+	{"Edg/", "Edge", ""},
+	{"OPR/", "Opera", ""},
+	{"Opera Mini/", "Opera Mini", ""},
+	{"Opera/9.80", "Opera", "Version/"},
+	{"Opera", "Opera", ""},
+	{"SamsungBrowser/", "Samsung Internet", ""},
+	{"UCBrowser/", "UC Browser", ""},
+	{"Vivaldi/", "Vivaldi", ""},
+	{"Maxthon/", "Maxthon", ""},
+	{"Puffin/", "Puffin", ""},
+	{"Epiphany/", "Epiphany", ""},
+	{"SeaMonkey/", "SeaMonkey", ""},
+	{"Iceweasel/", "Iceweasel", ""},
+	{"Camino/", "Camino", ""},
+	{"Konqueror/", "Konqueror", ""},
+	{"Chromium/", "Chromium", ""},
+	{"CriOS/", "Chrome", ""},
+	{"Chrome/", "Chrome", ""},
+	{"FxiOS/", "Firefox", ""},
+	{"Firefox/", "Firefox", ""},
+	{"MSIE ", "IE", ""},
+	{"Trident/", "IE", "rv:"},
+	{"Galeon/", "Galeon", ""},
+	{"iTunes/", "iTunes", ""},
+	{"ELinks", "ELinks", ""},
+	{"Links ", "Links", ""},
+	{"Lynx/", "Lynx", ""},
+	{"w3m/", "w3m", ""},
+	{"Wget/", "Wget", ""},
+	{"NetFront/", "NetFront", ""},
+	{"UP.Browser/", "Openwave", ""},
+	{"BrowserNG/", "Nokia Browser", ""},
+	{"NokiaBrowser/", "Nokia Browser", ""},
+	{"Android", "Android Browser", "Version/"},
+	{"Safari/", "Safari", "Version/"},
+}
+
+// osRules work like familyRules.
+var osRules = []struct {
+	token, os string
+}{
+	{"Windows Phone", "Windows Phone"},
+	{"Windows CE", "Windows CE"},
+	{"WindowsCE", "Windows CE"},
+	{"Windows", "Windows"},
+	{"Android", "Android"},
+	{"iPhone", "iOS"},
+	{"iPad", "iOS"},
+	{"iPod", "iOS"},
+	{"CrOS", "Chrome OS"},
+	{"Mac OS X", "macOS"},
+	{"Macintosh", "macOS"},
+	{"Darwin", "macOS"},
+	{"Symbian", "Symbian"},
+	{"SymbOS", "Symbian"},
+	{"Series60", "Symbian"},
+	{"MeeGo", "MeeGo"},
+	{"BlackBerry", "BlackBerry"},
+	{"BB10", "BlackBerry"},
+	{"RIM Tablet OS", "BlackBerry"},
+	{"webOS", "webOS"},
+	{"PalmOS", "Palm OS"},
+	{"OS/2", "OS/2"},
+	{"BeOS", "BeOS"},
+	{"SunOS", "Solaris"},
+	{"PLAYSTATION", "PlayStation"},
+	{"Nintendo", "Nintendo"},
+	{"BSD", "BSD"},
+	{"Linux", "Linux"},
+	{"X11", "Linux"},
+	{"MIDP", "J2ME"},
+	{"BREW", "BREW"},
+}
+
+const (
+	deviceDesktop = "desktop"
+	deviceMobile  = "mobile"
+	deviceTablet  = "tablet"
+	deviceBot     = "bot"
+	deviceOther   = "other"
+)
+
+// parseUserAgent reads the family, major version, OS and device class
+// of a user-agent string. What is not recognized is "Other".
+func parseUserAgent(ua string) agent {
+	a := agent{Family: "Other", OS: "Other", Device: deviceOther}
+	for _, rule := range familyRules {
+		i := strings.Index(ua, rule.token)
+		if i < 0 {
+			continue
+		}
+		a.Family = rule.family
+		switch rule.versionToken {
+		case "":
+			a.Version = majorVersion(ua[i+len(rule.token):])
+		case "-":
+		default:
+			if j := strings.Index(ua, rule.versionToken); j >= 0 {
+				a.Version = majorVersion(ua[j+len(rule.versionToken):])
+			}
+		}
+		break
+	}
+	for _, rule := range osRules {
+		if strings.Contains(ua, rule.token) {
+			a.OS = rule.os
+			break
+		}
+	}
+	a.Device = deviceClass(ua, a)
+	return a
+}
+
+// majorVersion returns the number s starts with, after slashes or spaces.
+func majorVersion(s string) string {
+	s = strings.TrimLeft(s, "/ ")
+	end := 0
+	for end < len(s) && '0' <= s[end] && s[end] <= '9' {
+		end++
+	}
+	return s[:end]
+}
+
+func deviceClass(ua string, a agent) string {
+	switch {
+	case a.Family == "Bot":
+		return deviceBot
+	case strings.Contains(ua, "iPad") || strings.Contains(ua, "Tablet"):
+		return deviceTablet
+	case a.OS == "Android" && !strings.Contains(ua, "Mobile"):
+		// Android phones say Mobile, tablets do not
+		return deviceTablet
+	case strings.Contains(ua, "Mobile") || strings.Contains(ua, "Mobi"):
+		return deviceMobile
+	}
+	switch a.OS {
+	case "iOS", "Windows Phone", "Windows CE", "Symbian", "MeeGo", "BlackBerry", "webOS", "Palm OS", "J2ME", "BREW":
+		return deviceMobile
+	case "Windows", "macOS", "Linux", "BSD", "Chrome OS", "OS/2", "BeOS", "Solaris":
+		return deviceDesktop
+	}
+	return deviceOther
+}
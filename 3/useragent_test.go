@@ -0,0 +1,34 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestParseUserAgent(t *testing.T) {
+	cases := map[string]agent{
+		"Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/41.0.2227.0 Safari/537.36": {
+			Family: "Chrome", Version: "41", OS: "Linux", Device: deviceDesktop},
+		"Mozilla/5.0 (Linux; U; Android 1.5; en-gb; T-Mobile_G2_Touch Build/CUPCAKE) AppleWebKit/528.5  (KHTML, like Gecko) Version/3.1.2 Mobile Safari/525.20.1": {
+			Family: "Android Browser", Version: "3", OS: "Android", Device: deviceMobile},
+		"Mozilla/4.0 (compatible; MSIE 7.0; Windows NT 6.0; Trident/5.0)": {
+			Family: "IE", Version: "7", OS: "Windows", Device: deviceDesktop},
+		"Mozilla/5.0 (Windows NT 10.0; WOW64; Trident/7.0; MATBJS; rv:11.0) like Gecko": {
+			Family: "IE", Version: "11", OS: "Windows", Device: deviceDesktop},
+		"Mozilla/5.0 (iPad; CPU OS 10_0 like Mac OS X) AppleWebKit/601.1 (KHTML, like Gecko) CriOS/49.0.2623.109 Mobile/14A5335b Safari/601.1.46": {
+			Family: "Chrome", Version: "49", OS: "iOS", Device: deviceTablet},
+		"Opera/9.80 (Windows NT 6.1; U; es-ES) Presto/2.9.181 Version/12.00": {
+			Family: "Opera", Version: "12", OS: "Windows", Device: deviceDesktop},
+		"Mozilla/5.0 (X11; Linux i686; rv:49.0) Gecko/20100101 Firefox/49.0": {
+			Family: "Firefox", Version: "49", OS: "Linux", Device: deviceDesktop},
+		"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)": {
+			Family: "Bot", OS: "Other", Device: deviceBot},
+		"LG-LX550 AU-MIC-LX550/2.0 MMP/2.0 Profile/MIDP-2.0 Configuration/CLDC-1.1": {
+			Family: "Other", OS: "J2ME", Device: deviceMobile},
+		"": {Family: "Other", OS: "Other", Device: deviceOther},
+	}
+	for ua, expected := range cases {
+		if got := parseUserAgent(ua); got != expected {
+			t.Errorf("results not match for %q\nGot:\n%+v\nExpected:\n%+v", ua, got, expected)
+		}
+	}
+}
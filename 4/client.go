@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -17,6 +18,17 @@ var (
 	client  = &http.Client{Timeout: time.Second}
 )
 
+// ошибки FindUsers, проверять через errors.Is
+var (
+	ErrBadToken      = errors.New("Bad AccessToken")
+	ErrBadOrderField = errors.New(ErrorBadOrderField)
+	ErrTimeout       = errors.New("timeout")
+	ErrServer        = errors.New("SearchServer fatal error")
+)
+
+// пауза перед первым повтором, если в SearchClient не задана
+const defaultBackoff = 100 * time.Millisecond
+
 type User struct {
 	Id     int
 	Name   string
@@ -55,10 +67,21 @@ type SearchClient struct {
 	AccessToken string
 	// урл внешней системы, куда идти
 	URL string
+	// клиент, которым делаются запросы, если nil - с таймаутом в 1 секунду
+	Client *http.Client
+	// сколько раз повторить запрос, упавший по таймауту или с 5xx
+	Retries int
+	// пауза перед первым повтором, дальше каждый раз удваивается
+	Backoff time.Duration
 }
 
 // FindUsers отправляет запрос во внешнюю систему, которая непосредственно ищет пользоваталей
 func (srv *SearchClient) FindUsers(req SearchRequest) (*SearchResponse, error) {
+	return srv.FindUsersContext(context.Background(), req)
+}
+
+// FindUsersContext - это FindUsers, который прекращает запрос и повторы по отмене ctx
+func (srv *SearchClient) FindUsersContext(ctx context.Context, req SearchRequest) (*SearchResponse, error) {
 
 	searcherParams := url.Values{}
 
@@ -81,24 +104,14 @@ func (srv *SearchClient) FindUsers(req SearchRequest) (*SearchResponse, error) {
 	searcherParams.Add("order_field", req.OrderField)
 	searcherParams.Add("order_by", strconv.Itoa(req.OrderBy))
 
-	searcherReq, err := http.NewRequest("GET", srv.URL+"?"+searcherParams.Encode(), nil)
-	searcherReq.Header.Add("AccessToken", srv.AccessToken)
-
-	resp, err := client.Do(searcherReq)
+	status, body, err := srv.do(ctx, searcherParams)
 	if err != nil {
-		if err, ok := err.(net.Error); ok && err.Timeout() {
-			return nil, fmt.Errorf("timeout for %s", searcherParams.Encode())
-		}
-		return nil, fmt.Errorf("unknown error %s", err)
+		return nil, err
 	}
-	defer resp.Body.Close()
-	body, err := ioutil.ReadAll(resp.Body)
 
-	switch resp.StatusCode {
+	switch status {
 	case http.StatusUnauthorized:
-		return nil, fmt.Errorf("Bad AccessToken")
-	case http.StatusInternalServerError:
-		return nil, fmt.Errorf("SearchServer fatal error")
+		return nil, ErrBadToken
 	case http.StatusBadRequest:
 		errResp := SearchErrorResponse{}
 		err = json.Unmarshal(body, &errResp)
@@ -106,7 +119,7 @@ func (srv *SearchClient) FindUsers(req SearchRequest) (*SearchResponse, error) {
 			return nil, fmt.Errorf("cant unpack error json: %s", err)
 		}
 		if errResp.Error == "ErrorBadOrderField" {
-			return nil, fmt.Errorf("OrderFeld %s invalid", req.OrderField)
+			return nil, fmt.Errorf("%w: %s", ErrBadOrderField, req.OrderField)
 		}
 		return nil, fmt.Errorf("unknown bad request error: %s", errResp.Error)
 	}
@@ -127,3 +140,69 @@ func (srv *SearchClient) FindUsers(req SearchRequest) (*SearchResponse, error) {
 
 	return &result, err
 }
+
+// do делает запрос, повторяя его при таймауте или 5xx, и возвращает статус и тело ответа
+func (srv *SearchClient) do(ctx context.Context, params url.Values) (int, []byte, error) {
+	httpClient := srv.Client
+	if httpClient == nil {
+		httpClient = client
+	}
+	backoff := srv.Backoff
+	if backoff <= 0 {
+		backoff = defaultBackoff
+	}
+
+	for attempt := 0; ; attempt++ {
+		status, body, err := srv.attempt(ctx, httpClient, params)
+		retry := errors.Is(err, ErrTimeout) || errors.Is(err, ErrServer)
+		if !retry || attempt >= srv.Retries || ctx.Err() != nil {
+			return status, body, err
+		}
+
+		timer := time.NewTimer(backoff << attempt)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return 0, nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func (srv *SearchClient) attempt(ctx context.Context, httpClient *http.Client, params url.Values) (int, []byte, error) {
+	searcherReq, err := http.NewRequestWithContext(ctx, "GET", srv.URL+"?"+params.Encode(), nil)
+	if err != nil {
+		return 0, nil, err
+	}
+	searcherReq.Header.Add("AccessToken", srv.AccessToken)
+
+	resp, err := httpClient.Do(searcherReq)
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			return 0, nil, err
+		}
+		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+			return 0, nil, &timeoutError{params: params.Encode(), err: err}
+		}
+		return 0, nil, fmt.Errorf("unknown error %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, fmt.Errorf("cant read response: %w", err)
+	}
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return resp.StatusCode, body, ErrServer
+	}
+	return resp.StatusCode, body, nil
+}
+
+// timeoutError - это ErrTimeout, под которым остается ошибка транспорта
+type timeoutError struct {
+	params string
+	err    error
+}
+
+func (e *timeoutError) Error() string        { return "timeout for " + e.params }
+func (e *timeoutError) Is(target error) bool { return target == ErrTimeout }
+func (e *timeoutError) Unwrap() error        { return e.err }
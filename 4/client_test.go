@@ -1,3 +1,256 @@
 package main
 
-// код писать тут
\ No newline at end of file
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testToken = "token"
+
+func newTestServer(t *testing.T) (*httptest.Server, []User) {
+	t.Helper()
+	users, err := LoadUsers("dataset.xml")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	ts := httptest.NewServer(&SearchServer{AccessToken: testToken, Users: users})
+	t.Cleanup(ts.Close)
+	return ts, users
+}
+
+func userIds(users []User) []int {
+	ids := []int{}
+	for _, u := range users {
+		ids = append(ids, u.Id)
+	}
+	return ids
+}
+
+func TestFindUsers(t *testing.T) {
+	ts, users := newTestServer(t)
+	client := &SearchClient{AccessToken: testToken, URL: ts.URL}
+
+	cases := []struct {
+		name     string
+		req      SearchRequest
+		ids      []int
+		nextPage bool
+	}{
+		{"as is", SearchRequest{Limit: 3}, []int{0, 1, 2}, true},
+		{"offset", SearchRequest{Limit: 2, Offset: 33}, []int{33, 34}, false},
+		{"past the end", SearchRequest{Limit: 5, Offset: 35}, []int{}, false},
+		{"id desc", SearchRequest{Limit: 2, OrderField: "Id", OrderBy: OrderByDesc}, []int{34, 33}, true},
+		{"age asc", SearchRequest{Limit: 4, OrderField: "Age", OrderBy: OrderByAsc}, []int{1, 15, 23, 0}, true},
+		{"name asc", SearchRequest{Limit: 2, OrderBy: OrderByAsc}, []int{15, 16}, true},
+		{"name desc", SearchRequest{Limit: 2, OrderField: "Name", OrderBy: OrderByDesc}, []int{13, 33}, true},
+		{"query in name", SearchRequest{Limit: 10, Query: "Boyd"}, []int{0}, false},
+		{"query in about", SearchRequest{Limit: 10, Query: "Nulla cillum enim"}, []int{0}, false},
+		{"no match", SearchRequest{Limit: 10, Query: "nobody"}, []int{}, false},
+		{"limit of 25", SearchRequest{Limit: 100}, userIds(users[:25]), true},
+		{"zero limit", SearchRequest{}, []int{}, true},
+	}
+	for _, c := range cases {
+		resp, err := client.FindUsers(c.req)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", c.name, err)
+		}
+		if ids := userIds(resp.Users); !reflect.DeepEqual(ids, c.ids) || resp.NextPage != c.nextPage {
+			t.Errorf("%s: results not match\nGot:\n%v %v\nExpected:\n%v %v", c.name, ids, resp.NextPage, c.ids, c.nextPage)
+		}
+	}
+}
+
+func TestFindUsersFields(t *testing.T) {
+	ts, _ := newTestServer(t)
+	client := &SearchClient{AccessToken: testToken, URL: ts.URL}
+	resp, err := client.FindUsers(SearchRequest{Limit: 1})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := User{
+		Id:     0,
+		Name:   "Boyd Wolf",
+		Age:    22,
+		About:  "Nulla cillum enim voluptate consequat laborum esse excepteur occaecat commodo nostrud excepteur ut cupidatat. Occaecat minim incididunt ut proident ad sint nostrud ad laborum sint pariatur. Ut nulla commodo dolore officia. Consequat anim eiusmod amet commodo eiusmod deserunt culpa. Ea sit dolore nostrud cillum proident nisi mollit est Lorem pariatur. Lorem aute officia deserunt dolor nisi aliqua consequat nulla nostrud ipsum irure id deserunt dolore. Minim reprehenderit nulla exercitation labore ipsum.",
+		Gender: "male",
+	}
+	if len(resp.Users) != 1 || resp.Users[0] != expected {
+		t.Errorf("results not match\nGot:\n%+v\nExpected:\n%+v", resp.Users, expected)
+	}
+}
+
+func TestFindUsersErrors(t *testing.T) {
+	ts, _ := newTestServer(t)
+	cases := []struct {
+		name   string
+		client *SearchClient
+		req    SearchRequest
+		err    error
+		text   string
+	}{
+		{"bad token", &SearchClient{AccessToken: "bad", URL: ts.URL}, SearchRequest{}, ErrBadToken, "Bad AccessToken"},
+		{"bad order field", &SearchClient{AccessToken: testToken, URL: ts.URL}, SearchRequest{OrderField: "About"}, ErrBadOrderField, "OrderField invalid: About"},
+		{"bad order by", &SearchClient{AccessToken: testToken, URL: ts.URL}, SearchRequest{OrderBy: 2}, nil, "unknown bad request error: ErrorBadOrderBy"},
+		{"negative limit", &SearchClient{AccessToken: testToken, URL: ts.URL}, SearchRequest{Limit: -1}, nil, "limit must be > 0"},
+		{"negative offset", &SearchClient{AccessToken: testToken, URL: ts.URL}, SearchRequest{Offset: -1}, nil, "offset must be > 0"},
+		{"no server", &SearchClient{AccessToken: testToken, URL: "http://127.0.0.1:1"}, SearchRequest{}, nil, "unknown error"},
+		{"bad url", &SearchClient{AccessToken: testToken, URL: "://"}, SearchRequest{}, nil, "parse"},
+	}
+	for _, c := range cases {
+		_, err := c.client.FindUsers(c.req)
+		if err == nil || !strings.HasPrefix(err.Error(), c.text) || c.err != nil && !errors.Is(err, c.err) {
+			t.Errorf("%s: wrong error\nGot: %v\nExpected: %s", c.name, err, c.text)
+		}
+	}
+
+	// the error of the transport is kept
+	_, err := (&SearchClient{URL: "http://127.0.0.1:1"}).FindUsers(SearchRequest{})
+	var urlErr *url.Error
+	if !errors.As(err, &urlErr) {
+		t.Errorf("wrong error\nGot: %v\nExpected: %T", err, urlErr)
+	}
+}
+
+// flakyServer fails the first requests with status, or by sleeping
+// past the timeout of the client if it is 0, then answers with users
+type flakyServer struct {
+	mu       sync.Mutex
+	failures int
+	status   int
+	sleep    time.Duration
+	requests int
+	next     http.Handler
+}
+
+func (s *flakyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests++
+	fail, status := s.requests <= s.failures, s.status
+	s.mu.Unlock()
+	switch {
+	case !fail:
+		s.next.ServeHTTP(w, r)
+	case status != 0:
+		w.WriteHeader(status)
+	default:
+		select {
+		case <-time.After(s.sleep):
+		case <-r.Context().Done():
+		}
+	}
+}
+
+func (s *flakyServer) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+func newFlakyServer(t *testing.T, failures, status int) (*flakyServer, *httptest.Server) {
+	t.Helper()
+	users, err := LoadUsers("dataset.xml")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	fs := &flakyServer{failures: failures, status: status, sleep: time.Second, next: &SearchServer{AccessToken: testToken, Users: users}}
+	ts := httptest.NewServer(fs)
+	t.Cleanup(ts.Close)
+	return fs, ts
+}
+
+func TestFindUsersRetries(t *testing.T) {
+	cases := []struct {
+		name     string
+		failures int
+		status   int
+		retries  int
+		err      error
+		requests int
+	}{
+		{"no retries", 1, http.StatusInternalServerError, 0, ErrServer, 1},
+		{"5xx then ok", 2, http.StatusBadGateway, 2, nil, 3},
+		{"5xx too many times", 3, http.StatusServiceUnavailable, 2, ErrServer, 3},
+		{"timeout then ok", 1, 0, 1, nil, 2},
+		{"timeout too many times", 2, 0, 1, ErrTimeout, 2},
+		{"4xx is not retried", 0, 0, 3, ErrBadToken, 1},
+	}
+	for _, c := range cases {
+		fs, ts := newFlakyServer(t, c.failures, c.status)
+		client := &SearchClient{
+			AccessToken: testToken,
+			URL:         ts.URL,
+			Client:      &http.Client{Timeout: 50 * time.Millisecond},
+			Retries:     c.retries,
+			Backoff:     time.Millisecond,
+		}
+		if c.err == ErrBadToken {
+			client.AccessToken = "bad"
+		}
+		resp, err := client.FindUsers(SearchRequest{Limit: 1})
+		if !errors.Is(err, c.err) || c.err == nil && len(resp.Users) != 1 {
+			t.Errorf("%s: wrong error\nGot: %v\nExpected: %v", c.name, err, c.err)
+		}
+		if fs.count() != c.requests {
+			t.Errorf("%s: results not match\nGot:\n%v\nExpected:\n%v", c.name, fs.count(), c.requests)
+		}
+	}
+}
+
+func TestFindUsersContext(t *testing.T) {
+	_, ts := newFlakyServer(t, 10, 0)
+	client := &SearchClient{AccessToken: testToken, URL: ts.URL, Retries: 5, Backoff: time.Hour}
+
+	// the deadline of the context is a timeout, which is not retried
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := client.FindUsersContext(ctx, SearchRequest{})
+	if !errors.Is(err, ErrTimeout) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("wrong error\nGot: %v\nExpected: %v, %v", err, ErrTimeout, context.DeadlineExceeded)
+	}
+
+	// canceling stops the backoff
+	fs, ts := newFlakyServer(t, 10, http.StatusInternalServerError)
+	client.URL = ts.URL
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	if _, err := client.FindUsersContext(ctx, SearchRequest{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("wrong error\nGot: %v\nExpected: %v", err, context.Canceled)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("backoff not canceled")
+	}
+	if fs.count() != 1 {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", fs.count(), 1)
+	}
+}
+
+func TestFindUsersBadJSON(t *testing.T) {
+	cases := []struct {
+		status int
+		body   string
+		err    string
+	}{
+		{http.StatusOK, "{", "cant unpack result json"},
+		{http.StatusBadRequest, "{", "cant unpack error json"},
+	}
+	for _, c := range cases {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(c.status)
+			w.Write([]byte(c.body))
+		}))
+		_, err := (&SearchClient{URL: ts.URL}).FindUsers(SearchRequest{})
+		ts.Close()
+		if err == nil || !strings.HasPrefix(err.Error(), c.err) {
+			t.Errorf("wrong error\nGot: %v\nExpected: %s", err, c.err)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"time"
+)
+
+// Usage: searchserver [-addr host:port] [-token token] [file]
+//
+// Serves the SearchServer of SearchClient over the users of file,
+// dataset.xml if it is missing. The access token defaults to
+// $SEARCH_ACCESS_TOKEN. Built by make searchserver.
+func main() {
+	opts, err := parseArgs(os.Args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if err := serve(ctx, opts); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+type options struct {
+	addr  string
+	token string
+	path  string
+}
+
+func parseArgs(args []string) (options, error) {
+	opts := options{path: "dataset.xml"}
+	fs := flag.NewFlagSet("searchserver", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.StringVar(&opts.addr, "addr", "localhost:8080", "address to listen on")
+	fs.StringVar(&opts.token, "token", os.Getenv("SEARCH_ACCESS_TOKEN"), "access token of the clients")
+	if err := fs.Parse(args); err != nil {
+		return options{}, err
+	}
+	if fs.NArg() > 1 {
+		return options{}, errors.New("too many arguments")
+	}
+	if fs.NArg() == 1 {
+		opts.path = fs.Arg(0)
+	}
+	if opts.token == "" {
+		return options{}, errors.New("no access token: set -token or SEARCH_ACCESS_TOKEN")
+	}
+	return opts, nil
+}
+
+// serve answers the searches until ctx is done, then lets the
+// requests being served finish.
+func serve(ctx context.Context, opts options) error {
+	users, err := LoadUsers(opts.path)
+	if err != nil {
+		return err
+	}
+	server := &http.Server{
+		Addr:              opts.addr,
+		Handler:           &SearchServer{AccessToken: opts.token, Users: users},
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- server.ListenAndServe()
+	}()
+	log.Printf("serving %d users of %s on %s", len(users), opts.path, opts.addr)
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+	shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return server.Shutdown(shutdown)
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// record is a user of the data file, in dataset.xml or a JSON array of
+// objects with the same keys.
+type record struct {
+	Id        int    `xml:"id" json:"id"`
+	FirstName string `xml:"first_name" json:"first_name"`
+	LastName  string `xml:"last_name" json:"last_name"`
+	Age       int    `xml:"age" json:"age"`
+	About     string `xml:"about" json:"about"`
+	Gender    string `xml:"gender" json:"gender"`
+}
+
+// LoadUsers reads the users of the file at path, XML like dataset.xml
+// or JSON.
+func LoadUsers(path string) ([]User, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	users, err := readUsers(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return users, nil
+}
+
+// readUsers reads XML or JSON, told apart by their first character.
+func readUsers(in io.Reader) ([]User, error) {
+	br := bufio.NewReader(in)
+	var first byte
+	for {
+		c, err := br.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if !strings.ContainsRune(" \t\r\n", rune(c)) {
+			first = c
+			br.UnreadByte()
+			break
+		}
+	}
+
+	var records []record
+	switch first {
+	case '<':
+		root := struct {
+			Rows []record `xml:"row"`
+		}{}
+		if err := xml.NewDecoder(br).Decode(&root); err != nil {
+			return nil, err
+		}
+		records = root.Rows
+	case '[':
+		if err := json.NewDecoder(br).Decode(&records); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("neither XML nor a JSON array")
+	}
+
+	users := make([]User, len(records))
+	for i, r := range records {
+		users[i] = User{
+			Id:     r.Id,
+			Name:   r.FirstName + " " + r.LastName,
+			Age:    r.Age,
+			About:  strings.TrimSpace(r.About),
+			Gender: r.Gender,
+		}
+	}
+	return users, nil
+}
+
+// requestError is a bad request, answered with a SearchErrorResponse.
+type requestError string
+
+func (e requestError) Error() string {
+	return string(e)
+}
+
+const (
+	errOrderField requestError = "ErrorBadOrderField"
+	errOrderBy    requestError = "ErrorBadOrderBy"
+	errLimit      requestError = "ErrorBadLimit"
+	errOffset     requestError = "ErrorBadOffset"
+)
+
+// SearchServer is the external system of SearchClient: it searches the
+// users for the requests with its access token.
+type SearchServer struct {
+	AccessToken string
+	Users       []User
+}
+
+func (s *SearchServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeJSON(w, http.StatusMethodNotAllowed, SearchErrorResponse{Error: "method not allowed"})
+		return
+	}
+	token := r.Header.Get("AccessToken")
+	if s.AccessToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(s.AccessToken)) != 1 {
+		writeJSON(w, http.StatusUnauthorized, SearchErrorResponse{Error: "bad AccessToken"})
+		return
+	}
+
+	req, err := parseSearchRequest(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, SearchErrorResponse{Error: err.Error()})
+		return
+	}
+	users, err := search(s.Users, req)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, SearchErrorResponse{Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, users)
+}
+
+func parseSearchRequest(r *http.Request) (SearchRequest, error) {
+	params := r.URL.Query()
+	req := SearchRequest{
+		Query:      params.Get("query"),
+		OrderField: params.Get("order_field"),
+	}
+	for _, p := range []struct {
+		name  string
+		value *int
+		err   requestError
+	}{
+		{"limit", &req.Limit, errLimit},
+		{"offset", &req.Offset, errOffset},
+		{"order_by", &req.OrderBy, errOrderBy},
+	} {
+		text := params.Get(p.name)
+		if text == "" {
+			continue
+		}
+		n, err := strconv.Atoi(text)
+		if err != nil {
+			return SearchRequest{}, p.err
+		}
+		*p.value = n
+	}
+	return req, nil
+}
+
+// search returns the users with the query in their name or about,
+// sorted and paged as req says. A limit of 0 is no limit.
+func search(users []User, req SearchRequest) ([]User, error) {
+	if req.Limit < 0 {
+		return nil, errLimit
+	}
+	if req.Offset < 0 {
+		return nil, errOffset
+	}
+	var less func(a, b *User) bool
+	switch req.OrderField {
+	case "Id":
+		less = func(a, b *User) bool { return a.Id < b.Id }
+	case "Age":
+		less = func(a, b *User) bool { return a.Age < b.Age }
+	case "Name", "":
+		less = func(a, b *User) bool { return a.Name < b.Name }
+	default:
+		return nil, errOrderField
+	}
+
+	found := []User{}
+	for _, u := range users {
+		if strings.Contains(u.Name, req.Query) || strings.Contains(u.About, req.Query) {
+			found = append(found, u)
+		}
+	}
+
+	switch req.OrderBy {
+	case OrderByAsIs:
+	case OrderByAsc:
+		sort.SliceStable(found, func(i, j int) bool { return less(&found[i], &found[j]) })
+	case OrderByDesc:
+		sort.SliceStable(found, func(i, j int) bool { return less(&found[j], &found[i]) })
+	default:
+		return nil, errOrderBy
+	}
+
+	if req.Offset >= len(found) {
+		return []User{}, nil
+	}
+	found = found[req.Offset:]
+	if req.Limit > 0 && req.Limit < len(found) {
+		found = found[:req.Limit]
+	}
+	return found, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("search: %s", err)
+		status = http.StatusInternalServerError
+		data, _ = json.Marshal(SearchErrorResponse{Error: "internal error"})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(data)
+}
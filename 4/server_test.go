@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadUsers(t *testing.T) {
+	xmlUsers := `
+<root>
+  <row><id>7</id><first_name>Ann</first_name><last_name>Lee</last_name><age>30</age><about>Hi
+</about><gender>female</gender><email>x</email></row>
+</root>`
+	jsonUsers := ` [{"id":7,"first_name":"Ann","last_name":"Lee","age":30,"about":" Hi","gender":"female","email":"x"}]`
+	expected := []User{{Id: 7, Name: "Ann Lee", Age: 30, About: "Hi", Gender: "female"}}
+
+	for _, data := range []string{xmlUsers, jsonUsers} {
+		users, err := readUsers(strings.NewReader(data))
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if !reflect.DeepEqual(users, expected) {
+			t.Errorf("results not match\nGot:\n%+v\nExpected:\n%+v", users, expected)
+		}
+	}
+
+	for _, bad := range []string{"", " ", "{}", "<root><row>", `[{"id":"x"}]`} {
+		if _, err := readUsers(strings.NewReader(bad)); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+	if _, err := LoadUsers("missing.xml"); err == nil {
+		t.Errorf("expected error for %s", "missing.xml")
+	}
+}
+
+func TestLoadUsersDataset(t *testing.T) {
+	users, err := LoadUsers("dataset.xml")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(users) != 35 {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", len(users), 35)
+	}
+	for i, u := range users {
+		if u.Id != i || u.Name == "" || u.About == "" || u.Gender == "" {
+			t.Errorf("wrong user %d: %+v", i, u)
+		}
+	}
+}
+
+func TestSearchServerErrors(t *testing.T) {
+	server := &SearchServer{AccessToken: testToken}
+	cases := []struct {
+		method, target, token string
+		status                int
+		err                   string
+	}{
+		{"GET", "/", "", http.StatusUnauthorized, "bad AccessToken"},
+		{"GET", "/", "tok", http.StatusUnauthorized, "bad AccessToken"},
+		{"POST", "/", testToken, http.StatusMethodNotAllowed, "method not allowed"},
+		{"GET", "/?limit=x", testToken, http.StatusBadRequest, "ErrorBadLimit"},
+		{"GET", "/?limit=-1", testToken, http.StatusBadRequest, "ErrorBadLimit"},
+		{"GET", "/?offset=1.5", testToken, http.StatusBadRequest, "ErrorBadOffset"},
+		{"GET", "/?offset=-2", testToken, http.StatusBadRequest, "ErrorBadOffset"},
+		{"GET", "/?order_by=asc", testToken, http.StatusBadRequest, "ErrorBadOrderBy"},
+		{"GET", "/?order_by=5", testToken, http.StatusBadRequest, "ErrorBadOrderBy"},
+		{"GET", "/?order_field=id", testToken, http.StatusBadRequest, "ErrorBadOrderField"},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest(c.method, c.target, nil)
+		if c.token != "" {
+			r.Header.Set("AccessToken", c.token)
+		}
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+
+		resp := SearchErrorResponse{}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if w.Code != c.status || resp.Error != c.err {
+			t.Errorf("%s %s: results not match\nGot:\n%d %s\nExpected:\n%d %s", c.method, c.target, w.Code, resp.Error, c.status, c.err)
+		}
+	}
+
+	// a server without a token lets nobody in
+	w := httptest.NewRecorder()
+	(&SearchServer{}).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", w.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	users := []User{{Id: 1, Name: "b", Age: 3}, {Id: 2, Name: "a", Age: 3}, {Id: 3, Name: "c", Age: 1, About: "x"}}
+	cases := []struct {
+		req SearchRequest
+		ids []int
+	}{
+		{SearchRequest{}, []int{1, 2, 3}},
+		{SearchRequest{OrderBy: OrderByAsc}, []int{2, 1, 3}},
+		{SearchRequest{OrderField: "Age", OrderBy: OrderByAsc}, []int{3, 1, 2}},
+		{SearchRequest{OrderField: "Age", OrderBy: OrderByDesc}, []int{1, 2, 3}},
+		{SearchRequest{Query: "x"}, []int{3}},
+		{SearchRequest{Offset: 1}, []int{2, 3}},
+		{SearchRequest{Offset: 1, Limit: 1}, []int{2}},
+		{SearchRequest{Offset: 3}, []int{}},
+	}
+	for _, c := range cases {
+		found, err := search(users, c.req)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if ids := userIds(found); !reflect.DeepEqual(ids, c.ids) {
+			t.Errorf("results not match for %+v\nGot:\n%v\nExpected:\n%v", c.req, ids, c.ids)
+		}
+	}
+}
+
+func TestParseArgs(t *testing.T) {
+	defer os.Setenv("SEARCH_ACCESS_TOKEN", os.Getenv("SEARCH_ACCESS_TOKEN"))
+	os.Setenv("SEARCH_ACCESS_TOKEN", "env")
+	opts, err := parseArgs([]string{"-addr", ":9000", "users.json"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if expected := (options{addr: ":9000", token: "env", path: "users.json"}); opts != expected {
+		t.Errorf("results not match\nGot:\n%+v\nExpected:\n%+v", opts, expected)
+	}
+
+	os.Setenv("SEARCH_ACCESS_TOKEN", "")
+	for _, args := range [][]string{{}, {"-token", "t", "a", "b"}, {"-x"}} {
+		if _, err := parseArgs(args); err == nil {
+			t.Errorf("expected error for %q", args)
+		}
+	}
+}
+
+func TestServe(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() {
+		errc <- serve(ctx, options{addr: "127.0.0.1:0", token: testToken, path: "dataset.xml"})
+	}()
+	cancel()
+	select {
+	case err := <-errc:
+		if err != nil {
+			t.Errorf("unexpected error: %s", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("server not shut down")
+	}
+
+	if err := serve(context.Background(), options{addr: "127.0.0.1:0", path: "missing.xml"}); err == nil {
+		t.Errorf("expected error for %s", "missing.xml")
+	}
+}